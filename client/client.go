@@ -0,0 +1,523 @@
+// Package client is a typed client of the JSON API of gitan described by /openapi.json
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskie/gitan/graphql"
+	"github.com/taskie/gitan/index"
+	"github.com/taskie/gitan/repo"
+	"github.com/taskie/gitan/server"
+)
+
+type Client struct {
+	// BaseURL is the URL of the base path of the server (e.g. "http://localhost:8080/")
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Error is an error response of the server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gitan: %d: %s", e.StatusCode, e.Message)
+}
+
+// GraphQLError is returned with partial data when a GraphQL query reports errors
+type GraphQLError struct {
+	Errors []*graphql.Error
+}
+
+func (e *GraphQLError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Message)
+	}
+	return "gitan: graphql: " + strings.Join(messages, "; ")
+}
+
+// Types of requests and responses are shared with the server so that they do not drift
+type (
+	SiteSpec           = server.SiteSpec
+	UserSpec           = server.UserSpec
+	RepoSpec           = server.RepoSpec
+	CommitSearchResult = server.CommitSearchResult
+	BatchObject        = server.BatchObject
+	BatchResult        = server.BatchResult
+)
+
+// RepoInfo is the response of the repo root
+type RepoInfo struct {
+	Branches []*repo.Revision `json:"branches"`
+	Metadata *repo.Metadata   `json:"metadata"`
+}
+
+type Tree struct {
+	Entries []*repo.TreeEntry `json:"entries"`
+	// Submodules are submodules descended to reach the directory
+	Submodules []*repo.Submodule `json:"submodules,omitempty"`
+}
+
+type TreeOptions struct {
+	Recursive bool
+	// Expand is optional fields: "size", "type" and "last_commit"
+	Expand []string
+	// Patterns, Kinds, MinSize, MaxSize and Limit filter recursive listings (see repo.FindOptions)
+	Patterns []string
+	Kinds    []repo.Kind
+	MinSize  int64
+	MaxSize  int64
+	Limit    int
+}
+
+type LogOptions struct {
+	Max int
+	// Pickaxe lists commits changing the number of occurrences of the string (or lines matching it if Regexp is set)
+	Pickaxe string
+	Regexp  bool
+	Paths   []string
+}
+
+type GrepOptions struct {
+	Paths      []string
+	IgnoreCase bool
+	Max        int
+}
+
+// CommitQuery filters commits; Site, User and Repo are used only by Client.SearchCommits
+type CommitQuery struct {
+	Message    string
+	Regexp     bool
+	IgnoreCase bool
+	Author     string
+	Committer  string
+	Since      time.Time
+	Until      time.Time
+	// Rev is the revision to search; empty means every allowed ref (or HEAD)
+	Rev  string
+	Max  int
+	Site string
+	User string
+	Repo string
+}
+
+type SearchQuery struct {
+	Text       string
+	IgnoreCase bool
+	Max        int
+	Site       string
+	User       string
+	Repo       string
+}
+
+func setString(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setBool(query url.Values, key string, value bool) {
+	if value {
+		query.Set(key, "true")
+	}
+}
+
+func setInt(query url.Values, key string, value int64) {
+	if value > 0 {
+		query.Set(key, strconv.FormatInt(value, 10))
+	}
+}
+
+func setTime(query url.Values, key string, value time.Time) {
+	if !value.IsZero() {
+		query.Set(key, value.Format(time.RFC3339))
+	}
+}
+
+func (q *CommitQuery) values() url.Values {
+	query := make(url.Values)
+	setString(query, "q", q.Message)
+	setBool(query, "regexp", q.Regexp)
+	setBool(query, "i", q.IgnoreCase)
+	setString(query, "author", q.Author)
+	setString(query, "committer", q.Committer)
+	setTime(query, "since", q.Since)
+	setTime(query, "until", q.Until)
+	setString(query, "rev", q.Rev)
+	setInt(query, "max", int64(q.Max))
+	return query
+}
+
+// url joins escaped elements to BaseURL; slashes in elements are kept as separators
+func (c *Client) url(query url.Values, elems ...string) string {
+	escaped := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		parts := strings.Split(elem, "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		escaped = append(escaped, strings.Join(parts, "/"))
+	}
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.Join(escaped, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *Client) do(ctx context.Context, method string, u string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		var e struct {
+			Error string `json:"error"`
+		}
+		bs, _ := ioutil.ReadAll(res.Body)
+		if json.Unmarshal(bs, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(bs))
+		}
+		return nil, &Error{StatusCode: res.StatusCode, Message: e.Error}
+	}
+	return res, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, u string, out interface{}) error {
+	return c.sendJSON(ctx, "GET", u, nil, out)
+}
+
+func (c *Client) sendJSON(ctx context.Context, method string, u string, body interface{}, out interface{}) error {
+	res, err := c.do(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *Client) getBytes(ctx context.Context, u string) ([]byte, error) {
+	res, err := c.do(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+func (c *Client) ListSites(ctx context.Context) ([]*SiteSpec, error) {
+	var res struct {
+		Sites []*SiteSpec `json:"sites"`
+	}
+	err := c.getJSON(ctx, c.url(nil, ""), &res)
+	return res.Sites, err
+}
+
+func (c *Client) ListUsers(ctx context.Context, siteName string) ([]*UserSpec, error) {
+	var res struct {
+		Users []*UserSpec `json:"users"`
+	}
+	err := c.getJSON(ctx, c.url(nil, siteName, ""), &res)
+	return res.Users, err
+}
+
+// ListRepos returns listed (not hidden) repos of the user registry
+func (c *Client) ListRepos(ctx context.Context, siteName, userName string, withMetadata bool) ([]*RepoSpec, error) {
+	query := make(url.Values)
+	setBool(query, "metadata", withMetadata)
+	var res struct {
+		Repos []*RepoSpec `json:"repos"`
+	}
+	err := c.getJSON(ctx, c.url(query, siteName, userName, ""), &res)
+	return res.Repos, err
+}
+
+// SearchCommits searches commits of every listed repo ordered by committer time
+func (c *Client) SearchCommits(ctx context.Context, q *CommitQuery) ([]*CommitSearchResult, error) {
+	query := q.values()
+	setString(query, "site", q.Site)
+	setString(query, "user", q.User)
+	setString(query, "repo", q.Repo)
+	var res struct {
+		Commits []*CommitSearchResult `json:"commits"`
+	}
+	err := c.getJSON(ctx, c.url(query, "search", "commits"), &res)
+	return res.Commits, err
+}
+
+// Search searches files of indexed repos (the server must be configured with an index)
+func (c *Client) Search(ctx context.Context, q *SearchQuery) ([]*index.Result, error) {
+	query := make(url.Values)
+	query.Set("q", q.Text)
+	setBool(query, "i", q.IgnoreCase)
+	setInt(query, "max", int64(q.Max))
+	setString(query, "site", q.Site)
+	setString(query, "user", q.User)
+	setString(query, "repo", q.Repo)
+	var res struct {
+		Results []*index.Result `json:"results"`
+	}
+	err := c.getJSON(ctx, c.url(query, "search"), &res)
+	return res.Results, err
+}
+
+// GraphQL executes the query and decodes its data into data; errors of fields are returned as *GraphQLError
+func (c *Client) GraphQL(ctx context.Context, req *graphql.Request, data interface{}) error {
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.url(nil, "graphql"), bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var gqlRes struct {
+		Data   json.RawMessage  `json:"data"`
+		Errors []*graphql.Error `json:"errors"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&gqlRes)
+	if err != nil {
+		return &Error{StatusCode: res.StatusCode, Message: err.Error()}
+	}
+	if len(gqlRes.Data) != 0 && data != nil {
+		err = json.Unmarshal(gqlRes.Data, data)
+		if err != nil {
+			return err
+		}
+	}
+	if len(gqlRes.Errors) != 0 {
+		return &GraphQLError{Errors: gqlRes.Errors}
+	}
+	return nil
+}
+
+// OpenAPI returns the OpenAPI document of the server
+func (c *Client) OpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	err := c.getJSON(ctx, c.url(nil, "openapi.json"), &doc)
+	return doc, err
+}
+
+// RepoClient calls the API of a repo
+type RepoClient struct {
+	client   *Client
+	siteName string
+	userName string
+	repoName string
+}
+
+func (c *Client) Repo(siteName, userName, repoName string) *RepoClient {
+	return &RepoClient{client: c, siteName: siteName, userName: userName, repoName: repoName}
+}
+
+func (rc *RepoClient) url(query url.Values, elems ...string) string {
+	return rc.client.url(query, append([]string{rc.siteName, rc.userName, rc.repoName}, elems...)...)
+}
+
+// Get returns branches and metadata of the repo
+func (rc *RepoClient) Get(ctx context.Context) (*RepoInfo, error) {
+	var res RepoInfo
+	err := rc.client.getJSON(ctx, rc.url(nil), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (opts *TreeOptions) values() url.Values {
+	query := make(url.Values)
+	if opts == nil {
+		return query
+	}
+	setBool(query, "recursive", opts.Recursive)
+	setString(query, "expand", strings.Join(opts.Expand, ","))
+	for _, pattern := range opts.Patterns {
+		query.Add("pattern", pattern)
+	}
+	kinds := make([]string, 0, len(opts.Kinds))
+	for _, kind := range opts.Kinds {
+		kinds = append(kinds, string(kind))
+	}
+	setString(query, "type", strings.Join(kinds, ","))
+	setInt(query, "min_size", opts.MinSize)
+	setInt(query, "max_size", opts.MaxSize)
+	setInt(query, "limit", int64(opts.Limit))
+	return query
+}
+
+// Tree lists entries of the directory at rev; opts may be nil
+func (rc *RepoClient) Tree(ctx context.Context, rev string, path string, opts *TreeOptions) (*Tree, error) {
+	var res Tree
+	err := rc.client.getJSON(ctx, rc.url(opts.values(), "tree", rev, path), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// WalkTree streams entries of the recursive listing of the directory to fn; Recursive of opts is implied
+func (rc *RepoClient) WalkTree(ctx context.Context, rev string, path string, opts *TreeOptions, fn func(*repo.TreeEntry) error) error {
+	query := opts.values()
+	query.Set("recursive", "true")
+	query.Set("format", "ndjson")
+	res, err := rc.client.do(ctx, "GET", rc.url(query, "tree", rev, path), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			repo.TreeEntry
+			OK    *bool  `json:"ok"`
+			Error string `json:"error"`
+		}
+		err := json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			return err
+		}
+		if line.OK != nil && !*line.OK {
+			return &Error{StatusCode: res.StatusCode, Message: line.Error}
+		}
+		te := line.TreeEntry
+		err = fn(&te)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// File returns the contents of the file at rev
+func (rc *RepoClient) File(ctx context.Context, rev string, path string) ([]byte, error) {
+	return rc.client.getBytes(ctx, rc.url(nil, "blob", rev, path))
+}
+
+// Blob returns the contents of the blob (refused by repos with restricted refs)
+func (rc *RepoClient) Blob(ctx context.Context, hash string) ([]byte, error) {
+	return rc.client.getBytes(ctx, rc.url(nil, "cat", hash))
+}
+
+// Batch returns contents of many files or blobs; errors of objects are reported in their results
+func (rc *RepoClient) Batch(ctx context.Context, objects []*BatchObject) ([]*BatchResult, error) {
+	req := server.BatchRequest{Objects: objects}
+	var res struct {
+		Objects []*BatchResult `json:"objects"`
+	}
+	err := rc.client.sendJSON(ctx, "POST", rc.url(nil, "batch"), &req, &res)
+	return res.Objects, err
+}
+
+// Commit returns the commit with its files
+func (rc *RepoClient) Commit(ctx context.Context, rev string) (*repo.Commit, error) {
+	var res repo.Commit
+	err := rc.client.getJSON(ctx, rc.url(nil, "commit", rev), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (rc *RepoClient) Resolve(ctx context.Context, rev string) (*repo.ResolvedRevision, error) {
+	var res struct {
+		Revision *repo.ResolvedRevision `json:"revision"`
+	}
+	err := rc.client.getJSON(ctx, rc.url(nil, "resolve", rev), &res)
+	return res.Revision, err
+}
+
+// Log returns commits reachable from rev; opts may be nil
+func (rc *RepoClient) Log(ctx context.Context, rev string, opts *LogOptions) ([]*repo.Commit, error) {
+	query := make(url.Values)
+	if opts != nil {
+		setInt(query, "max", int64(opts.Max))
+		setString(query, "pickaxe", opts.Pickaxe)
+		setBool(query, "regexp", opts.Regexp)
+		for _, path := range opts.Paths {
+			query.Add("path", path)
+		}
+	}
+	var res struct {
+		Commits []*repo.Commit `json:"commits"`
+	}
+	err := rc.client.getJSON(ctx, rc.url(query, "log", rev), &res)
+	return res.Commits, err
+}
+
+// Grep searches lines matching the regular expression; opts may be nil
+func (rc *RepoClient) Grep(ctx context.Context, rev string, pattern string, opts *GrepOptions) ([]*repo.GrepMatch, error) {
+	query := make(url.Values)
+	query.Set("q", pattern)
+	if opts != nil {
+		for _, path := range opts.Paths {
+			query.Add("path", path)
+		}
+		setBool(query, "i", opts.IgnoreCase)
+		setInt(query, "max", int64(opts.Max))
+	}
+	var res struct {
+		Matches []*repo.GrepMatch `json:"matches"`
+	}
+	err := rc.client.getJSON(ctx, rc.url(query, "grep", rev), &res)
+	return res.Matches, err
+}
+
+func (rc *RepoClient) SearchCommits(ctx context.Context, q *CommitQuery) ([]*repo.Commit, error) {
+	var res struct {
+		Commits []*repo.Commit `json:"commits"`
+	}
+	err := rc.client.getJSON(ctx, rc.url(q.values(), "search", "commits"), &res)
+	return res.Commits, err
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+	"github.com/taskie/gitan/server"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// newTestServer serves s/u/r which has dir/sub/file.txt on master
+func newTestServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	fs := memfs.New()
+	repository, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Create("dir/sub/file.txt")
+	if err == nil {
+		_, err = f.Write([]byte("contents\n"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		_, err = worktree.Add("dir/sub/file.txt")
+	}
+	if err == nil {
+		_, err = worktree.Commit("first", &git.CommitOptions{
+			Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server.Server{Sites: make(map[string]*server.Site), BathPath: "/"}
+	s.AddRepo("s", "u", "r", repo.NewRepoWithRepository(repository), nil)
+	return httptest.NewServer(s.Router())
+}
+
+func TestClient(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ctx := context.Background()
+	c := New(ts.URL + "/")
+
+	sites, err := c.ListSites(ctx)
+	if err != nil || len(sites) != 1 || sites[0].Name != "s" {
+		t.Errorf("ListSites() = %v, %v", sites, err)
+	}
+	users, err := c.ListUsers(ctx, "s")
+	if err != nil || len(users) != 1 || users[0].Name != "u" {
+		t.Errorf("ListUsers() = %v, %v", users, err)
+	}
+	repos, err := c.ListRepos(ctx, "s", "u", true)
+	if err != nil || len(repos) != 1 || repos[0].Name != "r" || repos[0].Metadata == nil {
+		t.Errorf("ListRepos() = %v, %v", repos, err)
+	}
+
+	rc := c.Repo("s", "u", "r")
+	tree, err := rc.Tree(ctx, "master", "dir/sub", nil)
+	if err != nil || len(tree.Entries) != 1 || tree.Entries[0].Name != "file.txt" {
+		t.Errorf("Tree() = %+v, %v", tree, err)
+	}
+	bs, err := rc.File(ctx, "master", "dir/sub/file.txt")
+	if err != nil || string(bs) != "contents\n" {
+		t.Errorf("File() = %q, %v", bs, err)
+	}
+	results, err := rc.Batch(ctx, []*BatchObject{
+		{Rev: "master", Path: "dir/sub/file.txt"},
+		{Rev: "master", Path: "missing.txt"},
+	})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Batch() = %v, %v", results, err)
+	}
+	if string(results[0].Content) != "contents\n" || results[0].Stat == nil || results[0].Path != "dir/sub/file.txt" {
+		t.Errorf("Batch()[0] = %+v", results[0])
+	}
+	if results[1].Error == "" {
+		t.Errorf("Batch()[1] = %+v, want an error", results[1])
+	}
+
+	_, err = rc.File(ctx, "master", "missing.txt")
+	if e, ok := err.(*Error); !ok || e.StatusCode != 404 {
+		t.Errorf("File() of a missing file = %v, want 404", err)
+	}
+}
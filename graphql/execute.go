@@ -0,0 +1,579 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Type is a *Scalar, *List or *Object
+type Type interface {
+	String() string
+}
+
+type Scalar struct {
+	Name string
+}
+
+func (t *Scalar) String() string { return t.Name }
+
+var (
+	String  = &Scalar{Name: "String"}
+	Int     = &Scalar{Name: "Int"}
+	Float   = &Scalar{Name: "Float"}
+	Boolean = &Scalar{Name: "Boolean"}
+	ID      = &Scalar{Name: "ID"}
+)
+
+type List struct {
+	OfType Type
+}
+
+func NewList(t Type) *List {
+	return &List{OfType: t}
+}
+
+func (t *List) String() string { return "[" + t.OfType.String() + "]" }
+
+// Object is an output type; every field is nullable
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+func (t *Object) String() string { return t.Name }
+
+// Argument is an input of a field; Default is used when the argument is omitted
+type Argument struct {
+	Type    Type
+	Default interface{}
+}
+
+// FieldDef defines a field of an Object
+type FieldDef struct {
+	Type Type
+	Args map[string]*Argument
+	// Resolve returns the value of the field; nil looks up the field name in the source map[string]interface{}
+	Resolve func(p *ResolveParams) (interface{}, error)
+	// Complexity returns the cost of the field from its arguments and the cost of its selections; nil means 1 + childComplexity
+	Complexity func(args Args, childComplexity int) int
+}
+
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    Args
+}
+
+// Args are coerced arguments: nil, bool, int, float64, string or []interface{} of them
+type Args map[string]interface{}
+
+func (args Args) String(name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func (args Args) Int(name string) int {
+	n, _ := args[name].(int)
+	return n
+}
+
+func (args Args) Bool(name string) bool {
+	b, _ := args[name].(bool)
+	return b
+}
+
+func (args Args) Strings(name string) []string {
+	xs, _ := args[name].([]interface{})
+	ss := make([]string, 0, len(xs))
+	for _, x := range xs {
+		if s, ok := x.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// Schema is the type system of queries; mutations, subscriptions and introspection are not supported
+type Schema struct {
+	Query *Object
+	// MaxDepth limits the nesting of fields; 0 means unlimited
+	MaxDepth int
+	// MaxComplexity limits the total cost of fields (see FieldDef.Complexity); 0 means unlimited
+	MaxComplexity int
+}
+
+type Request struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// orderedMap is a JSON object which keeps the order of selections
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		bs, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bs)
+		buf.WriteByte(':')
+		bs, err = json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bs)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type executor struct {
+	schema    *Schema
+	ctx       context.Context
+	fragments map[string]*Fragment
+	variables map[string]interface{}
+	declared  map[string]bool
+	errors    []*Error
+}
+
+// fieldGroup is fields sharing a response key which are executed at once
+type fieldGroup struct {
+	key    string
+	fields []*Field
+}
+
+func (g *fieldGroup) selectionSet() []Selection {
+	if len(g.fields) == 1 {
+		return g.fields[0].SelectionSet
+	}
+	selections := make([]Selection, 0)
+	for _, f := range g.fields {
+		selections = append(selections, f.SelectionSet...)
+	}
+	return selections
+}
+
+// Execute runs the query of the request; errors of fields are reported with null values of them
+func (s *Schema) Execute(ctx context.Context, req *Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return errorResponse(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if op.Type != "query" {
+		return errorResponse(fmt.Errorf("%s operations are not supported", op.Type))
+	}
+	e := &executor{
+		schema:    s,
+		ctx:       ctx,
+		fragments: doc.Fragments,
+		variables: make(map[string]interface{}),
+		declared:  make(map[string]bool),
+	}
+	for _, def := range op.Variables {
+		e.declared[def.Name] = true
+		if v, ok := req.Variables[def.Name]; ok {
+			e.variables[def.Name] = v
+		} else if def.Default != nil {
+			e.variables[def.Name] = def.Default
+		}
+	}
+	_, err = e.complexity(s.Query, op.SelectionSet, 1)
+	if err != nil {
+		return errorResponse(err)
+	}
+	data := e.executeSelections(s.Query, nil, op.SelectionSet, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func errorResponse(err error) *Response {
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+func (doc *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with multiple operations")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation: %s", name)
+}
+
+// value substitutes variables in the literal
+func (e *executor) value(v Value) (interface{}, error) {
+	switch v := v.(type) {
+	case Variable:
+		if !e.declared[string(v)] {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		return e.variables[string(v)], nil
+	case Enum:
+		return string(v), nil
+	case []Value:
+		xs := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			x, err := e.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			xs = append(xs, x)
+		}
+		return xs, nil
+	case map[string]Value:
+		return nil, fmt.Errorf("input objects are not supported")
+	}
+	return v, nil
+}
+
+func coerce(t Type, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if list, ok := t.(*List); ok {
+		xs, ok := v.([]interface{})
+		if !ok {
+			x, err := coerce(list.OfType, v)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{x}, nil
+		}
+		results := make([]interface{}, 0, len(xs))
+		for _, x := range xs {
+			x, err := coerce(list.OfType, x)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, x)
+		}
+		return results, nil
+	}
+	switch t {
+	case Int:
+		switch v := v.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+				return int(v), nil
+			}
+		case json.Number:
+			if n, err := strconv.Atoi(v.String()); err == nil {
+				return n, nil
+			}
+		}
+	case Float:
+		switch v := v.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case json.Number:
+			return v.Float64()
+		}
+	case String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case ID:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		}
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s but got %v", t, v)
+}
+
+func (e *executor) arguments(name string, defs map[string]*Argument, values map[string]Value) (Args, error) {
+	args := make(Args)
+	for argName, v := range values {
+		def := defs[argName]
+		if def == nil {
+			return nil, fmt.Errorf("unknown argument %q of %s", argName, name)
+		}
+		x, err := e.value(v)
+		if err != nil {
+			return nil, err
+		}
+		x, err = coerce(def.Type, x)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q of %s: %s", argName, name, err)
+		}
+		if x != nil {
+			args[argName] = x
+		}
+	}
+	for argName, def := range defs {
+		if _, ok := args[argName]; !ok && def.Default != nil {
+			args[argName] = def.Default
+		}
+	}
+	return args, nil
+}
+
+// shouldInclude evaluates @skip and @include
+func (e *executor) shouldInclude(selection Selection) (bool, error) {
+	for _, directive := range selection.directives() {
+		switch directive.Name {
+		case "skip", "include":
+			args, err := e.arguments("@"+directive.Name, map[string]*Argument{"if": {Type: Boolean}}, directive.Arguments)
+			if err != nil {
+				return false, err
+			}
+			cond, ok := args["if"].(bool)
+			if !ok {
+				return false, fmt.Errorf("argument \"if\" of @%s is required", directive.Name)
+			}
+			if cond == (directive.Name == "skip") {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unknown directive: @%s", directive.Name)
+		}
+	}
+	return true, nil
+}
+
+// collectFields groups fields by response keys expanding fragments which apply to the type
+func (e *executor) collectFields(t *Object, selections []Selection, groups []*fieldGroup, visited map[string]bool) ([]*fieldGroup, error) {
+	for _, selection := range selections {
+		ok, err := e.shouldInclude(selection)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		switch selection := selection.(type) {
+		case *Field:
+			key := selection.ResponseKey()
+			var group *fieldGroup
+			for _, g := range groups {
+				if g.key == key {
+					group = g
+					break
+				}
+			}
+			if group == nil {
+				group = &fieldGroup{key: key}
+				groups = append(groups, group)
+			} else if group.fields[0].Name != selection.Name {
+				return nil, fmt.Errorf("fields %q and %q conflict because they have the same response key %q", group.fields[0].Name, selection.Name, key)
+			}
+			group.fields = append(group.fields, selection)
+		case *FragmentSpread:
+			if visited[selection.Name] {
+				continue
+			}
+			visited[selection.Name] = true
+			fragment := e.fragments[selection.Name]
+			if fragment == nil {
+				return nil, fmt.Errorf("unknown fragment: %s", selection.Name)
+			}
+			if fragment.TypeCondition != t.Name {
+				continue
+			}
+			groups, err = e.collectFields(t, fragment.SelectionSet, groups, visited)
+			if err != nil {
+				return nil, err
+			}
+		case *InlineFragment:
+			if selection.TypeCondition != "" && selection.TypeCondition != t.Name {
+				continue
+			}
+			groups, err = e.collectFields(t, selection.SelectionSet, groups, visited)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return groups, nil
+}
+
+func namedType(t Type) Type {
+	for {
+		list, ok := t.(*List)
+		if !ok {
+			return t
+		}
+		t = list.OfType
+	}
+}
+
+// maxComplexity is the cost which costs saturate at so that they never overflow
+const maxComplexity = math.MaxInt32
+
+// addComplexity adds costs saturating at maxComplexity; negative costs are treated as overflowed
+func addComplexity(x int, y int) int {
+	if x < 0 || y < 0 || x > maxComplexity-y {
+		return maxComplexity
+	}
+	return x + y
+}
+
+// complexity validates the selections and returns their total cost.
+// It fails as soon as the cost exceeds MaxComplexity so that costs of deeply nested lists are bounded.
+func (e *executor) complexity(t *Object, selections []Selection, depth int) (int, error) {
+	if e.schema.MaxDepth > 0 && depth > e.schema.MaxDepth {
+		return 0, fmt.Errorf("query depth exceeds the limit %d", e.schema.MaxDepth)
+	}
+	groups, err := e.collectFields(t, selections, nil, make(map[string]bool))
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, group := range groups {
+		f := group.fields[0]
+		if f.Name == "__typename" {
+			continue
+		}
+		def := t.Fields[f.Name]
+		if def == nil {
+			return 0, fmt.Errorf("cannot query field %q on type %q", f.Name, t.Name)
+		}
+		args, err := e.arguments(t.Name+"."+f.Name, def.Args, f.Arguments)
+		if err != nil {
+			return 0, err
+		}
+		child := 0
+		subSelections := group.selectionSet()
+		if obj, ok := namedType(def.Type).(*Object); ok {
+			if len(subSelections) == 0 {
+				return 0, fmt.Errorf("field %q of type %q must have a selection of subfields", f.Name, def.Type)
+			}
+			child, err = e.complexity(obj, subSelections, depth+1)
+			if err != nil {
+				return 0, err
+			}
+		} else if len(subSelections) != 0 {
+			return 0, fmt.Errorf("field %q must not have a selection since type %q has no subfields", f.Name, def.Type)
+		}
+		cost := addComplexity(1, child)
+		if def.Complexity != nil {
+			cost = addComplexity(0, def.Complexity(args, child))
+		}
+		total = addComplexity(total, cost)
+		if e.schema.MaxComplexity > 0 && total > e.schema.MaxComplexity {
+			return 0, fmt.Errorf("query complexity exceeds the limit %d", e.schema.MaxComplexity)
+		}
+	}
+	return total, nil
+}
+
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	result := make([]interface{}, len(path)+1)
+	copy(result, path)
+	result[len(path)] = elem
+	return result
+}
+
+// executeSelections resolves the selections which are already validated by complexity
+func (e *executor) executeSelections(t *Object, source interface{}, selections []Selection, path []interface{}) *orderedMap {
+	result := &orderedMap{values: make(map[string]interface{})}
+	groups, _ := e.collectFields(t, selections, nil, make(map[string]bool))
+	for _, group := range groups {
+		f := group.fields[0]
+		if f.Name == "__typename" {
+			result.set(group.key, t.Name)
+			continue
+		}
+		def := t.Fields[f.Name]
+		fieldPath := appendPath(path, group.key)
+		args, _ := e.arguments(t.Name+"."+f.Name, def.Args, f.Arguments)
+		var v interface{}
+		var err error
+		if def.Resolve != nil {
+			v, err = def.Resolve(&ResolveParams{Context: e.ctx, Source: source, Args: args})
+		} else if m, ok := source.(map[string]interface{}); ok {
+			v = m[f.Name]
+		}
+		if err != nil {
+			e.errors = append(e.errors, &Error{Message: err.Error(), Path: fieldPath})
+			result.set(group.key, nil)
+			continue
+		}
+		result.set(group.key, e.completeValue(def.Type, v, group.selectionSet(), fieldPath))
+	}
+	return result
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func (e *executor) completeValue(t Type, v interface{}, selections []Selection, path []interface{}) interface{} {
+	if isNil(v) {
+		return nil
+	}
+	switch t := t.(type) {
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.errors = append(e.errors, &Error{Message: fmt.Sprintf("expected a list but got %T", v), Path: path})
+			return nil
+		}
+		results := make([]interface{}, rv.Len())
+		for i := range results {
+			results[i] = e.completeValue(t.OfType, rv.Index(i).Interface(), selections, appendPath(path, i))
+		}
+		return results
+	case *Object:
+		return e.executeSelections(t, v, selections, path)
+	}
+	return v
+}
@@ -0,0 +1,382 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testPerson struct {
+	name    string
+	age     int
+	friends []string
+}
+
+var testPeople = map[string]*testPerson{
+	"alice": {name: "alice", age: 30, friends: []string{"bob", "carol"}},
+	"bob":   {name: "bob", age: 25, friends: []string{"alice"}},
+	"carol": {name: "carol", age: 35},
+}
+
+// newTestSchema has people who have friends:
+//
+//	type Query { person(name: String): Person, people(first: Int): [Person], echo(...): String, map: Map }
+//	type Person { name: String, age: Int, friends(first: Int): [Person], greet(greeting: String = "Hello"): String, fail: String }
+//	type Map { key: String }
+func newTestSchema() *Schema {
+	personType := &Object{Name: "Person"}
+	listComplexity := func(args Args, child int) int {
+		n := args.Int("first")
+		if n <= 0 {
+			n = 10
+		}
+		return 1 + n*child
+	}
+	personType.Fields = map[string]*FieldDef{
+		"name": {
+			Type: String,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				return p.Source.(*testPerson).name, nil
+			},
+		},
+		"age": {
+			Type: Int,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				return p.Source.(*testPerson).age, nil
+			},
+		},
+		"friends": {
+			Type:       NewList(personType),
+			Args:       map[string]*Argument{"first": {Type: Int}},
+			Complexity: listComplexity,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				friends := make([]*testPerson, 0)
+				for _, name := range p.Source.(*testPerson).friends {
+					friends = append(friends, testPeople[name])
+				}
+				if first := p.Args.Int("first"); first > 0 && len(friends) > first {
+					friends = friends[:first]
+				}
+				return friends, nil
+			},
+		},
+		"greet": {
+			Type: String,
+			Args: map[string]*Argument{"greeting": {Type: String, Default: "Hello"}},
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				return p.Args.String("greeting") + ", " + p.Source.(*testPerson).name, nil
+			},
+		},
+		"fail": {
+			Type: String,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				return nil, fmt.Errorf("%s failed", p.Source.(*testPerson).name)
+			},
+		},
+	}
+	mapType := &Object{Name: "Map", Fields: map[string]*FieldDef{"key": {Type: String}}}
+	query := &Object{Name: "Query"}
+	query.Fields = map[string]*FieldDef{
+		"person": {
+			Type: personType,
+			Args: map[string]*Argument{"name": {Type: String}},
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				if person := testPeople[p.Args.String("name")]; person != nil {
+					return person, nil
+				}
+				return nil, nil
+			},
+		},
+		"people": {
+			Type:       NewList(personType),
+			Args:       map[string]*Argument{"first": {Type: Int}},
+			Complexity: listComplexity,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				people := []*testPerson{testPeople["alice"], testPeople["bob"], testPeople["carol"]}
+				if first := p.Args.Int("first"); first > 0 && len(people) > first {
+					people = people[:first]
+				}
+				return people, nil
+			},
+		},
+		"echo": {
+			Type: String,
+			Args: map[string]*Argument{
+				"s":    {Type: String},
+				"i":    {Type: Int},
+				"f":    {Type: Float},
+				"b":    {Type: Boolean},
+				"id":   {Type: ID},
+				"list": {Type: NewList(Int)},
+			},
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				bs, err := json.Marshal(p.Args)
+				return string(bs), err
+			},
+		},
+		"map": {
+			Type: mapType,
+			Resolve: func(p *ResolveParams) (interface{}, error) {
+				return map[string]interface{}{"key": "value"}, nil
+			},
+		},
+	}
+	return &Schema{Query: query}
+}
+
+// execute runs the query and returns the JSON of the response
+func execute(t *testing.T, schema *Schema, req *Request) string {
+	bs, err := json.Marshal(schema.Execute(context.Background(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		operation string
+		want      string
+	}{
+		{
+			name:  "fields in order of selections",
+			query: `{ person(name: "alice") { age name } }`,
+			want:  `{"data":{"person":{"age":30,"name":"alice"}}}`,
+		},
+		{
+			name:  "nested lists",
+			query: `{ people(first: 2) { name friends { name } } }`,
+			want:  `{"data":{"people":[{"name":"alice","friends":[{"name":"bob"},{"name":"carol"}]},{"name":"bob","friends":[{"name":"alice"}]}]}}`,
+		},
+		{
+			name:  "null objects",
+			query: `{ person(name: "dave") { name } }`,
+			want:  `{"data":{"person":null}}`,
+		},
+		{
+			name:  "aliases",
+			query: `{ a: person(name: "alice") { n: name } b: person(name: "bob") { name } }`,
+			want:  `{"data":{"a":{"n":"alice"},"b":{"name":"bob"}}}`,
+		},
+		{
+			name:  "merged fields of the same response key",
+			query: `{ person(name: "alice") { name } person(name: "alice") { age name } }`,
+			want:  `{"data":{"person":{"name":"alice","age":30}}}`,
+		},
+		{
+			name:  "default arguments",
+			query: `{ person(name: "bob") { greet hi: greet(greeting: "Hi") } }`,
+			want:  `{"data":{"person":{"greet":"Hello, bob","hi":"Hi, bob"}}}`,
+		},
+		{
+			name:  "null arguments are omitted",
+			query: `{ person(name: "bob") { greet(greeting: null) } }`,
+			want:  `{"data":{"person":{"greet":"Hello, bob"}}}`,
+		},
+		{
+			name:  "coerced arguments",
+			query: `{ echo(s: "x", i: 1, f: 2, b: true, id: 3, list: 4) }`,
+			want:  `{"data":{"echo":"{\"b\":true,\"f\":2,\"i\":1,\"id\":\"3\",\"list\":[4],\"s\":\"x\"}"}}`,
+		},
+		{
+			name:  "fragments",
+			query: `{ person(name: "alice") { ...person friends(first: 1) { ...person } } } fragment person on Person { name age }`,
+			want:  `{"data":{"person":{"name":"alice","age":30,"friends":[{"name":"bob","age":25}]}}}`,
+		},
+		{
+			name:  "fragments of other types are ignored",
+			query: `{ person(name: "alice") { ...m name ... on Map { key } } } fragment m on Map { key }`,
+			want:  `{"data":{"person":{"name":"alice"}}}`,
+		},
+		{
+			name:  "inline fragments",
+			query: `{ person(name: "carol") { ... on Person { name } ... { age } } }`,
+			want:  `{"data":{"person":{"name":"carol","age":35}}}`,
+		},
+		{
+			name:  "recursive fragments are expanded once",
+			query: `{ person(name: "carol") { ...f } } fragment f on Person { name ...f }`,
+			want:  `{"data":{"person":{"name":"carol"}}}`,
+		},
+		{
+			name:  "__typename",
+			query: `{ __typename person(name: "bob") { __typename } map { t: __typename key } }`,
+			want:  `{"data":{"__typename":"Query","person":{"__typename":"Person"},"map":{"t":"Map","key":"value"}}}`,
+		},
+		{
+			name:  "fields of maps without resolvers",
+			query: `{ map { key } }`,
+			want:  `{"data":{"map":{"key":"value"}}}`,
+		},
+		{
+			name:      "variables",
+			query:     `query ($name: String, $first: Int = 1) { person(name: $name) { friends(first: $first) { name } } }`,
+			variables: map[string]interface{}{"name": "alice"},
+			want:      `{"data":{"person":{"friends":[{"name":"bob"}]}}}`,
+		},
+		{
+			name:      "variables decoded from JSON",
+			query:     `query ($i: Int, $list: [Int]) { echo(i: $i, list: $list) }`,
+			variables: map[string]interface{}{"i": 1.0, "list": []interface{}{2.0, 3.0}},
+			want:      `{"data":{"echo":"{\"i\":1,\"list\":[2,3]}"}}`,
+		},
+		{
+			name:      "variables in lists",
+			query:     `query ($i: Int) { echo(list: [1, $i]) }`,
+			variables: map[string]interface{}{"i": 2},
+			want:      `{"data":{"echo":"{\"list\":[1,2]}"}}`,
+		},
+		{
+			name:  "skip and include",
+			query: `{ person(name: "bob") { name @skip(if: true) age @include(if: false) greet @skip(if: false) @include(if: true) } }`,
+			want:  `{"data":{"person":{"greet":"Hello, bob"}}}`,
+		},
+		{
+			name:      "skip and include with variables",
+			query:     `query ($yes: Boolean!) { person(name: "bob") { ... @include(if: $yes) { name } ...f @skip(if: $yes) } } fragment f on Person { age }`,
+			variables: map[string]interface{}{"yes": true},
+			want:      `{"data":{"person":{"name":"bob"}}}`,
+		},
+		{
+			name:      "operation name",
+			query:     `query A { a: person(name: "alice") { name } } query B { b: person(name: "bob") { name } }`,
+			operation: "B",
+			want:      `{"data":{"b":{"name":"bob"}}}`,
+		},
+		{
+			name:  "field errors",
+			query: `{ people { name fail } }`,
+			want: `{"data":{"people":[{"name":"alice","fail":null},{"name":"bob","fail":null},{"name":"carol","fail":null}]},` +
+				`"errors":[{"message":"alice failed","path":["people",0,"fail"]},{"message":"bob failed","path":["people",1,"fail"]},{"message":"carol failed","path":["people",2,"fail"]}]}`,
+		},
+	}
+	schema := newTestSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := execute(t, schema, &Request{Query: tt.query, OperationName: tt.operation, Variables: tt.variables})
+			if got != tt.want {
+				t.Errorf("Execute() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		operation string
+		want      string
+	}{
+		{"syntax error", `{ person(`, nil, "", "syntax error"},
+		{"mutations", `mutation { person { name } }`, nil, "", "mutation operations are not supported"},
+		{"subscriptions", `subscription { person { name } }`, nil, "", "subscription operations are not supported"},
+		{"ambiguous operations", `query A { map { key } } query B { map { key } }`, nil, "", "operationName is required"},
+		{"unknown operations", `query A { map { key } }`, nil, "B", "unknown operation: B"},
+		{"unknown fields", `{ person(name: "alice") { email } }`, nil, "", `cannot query field "email" on type "Person"`},
+		{"unknown arguments", `{ person(id: 1) { name } }`, nil, "", `unknown argument "id" of Query.person`},
+		{"invalid arguments", `{ person(name: 1) { name } }`, nil, "", `argument "name" of Query.person: expected String but got 1`},
+		{"invalid integers", `{ echo(i: 1.5) }`, nil, "", `argument "i" of Query.echo: expected Int but got 1.5`},
+		{"invalid list elements", `{ echo(list: [1, "a"]) }`, nil, "", `argument "list" of Query.echo: expected Int but got a`},
+		{"input objects", `{ echo(s: {a: 1}) }`, nil, "", "input objects are not supported"},
+		{"invalid variables", `query ($n: String) { person(name: $n) { name } }`, map[string]interface{}{"n": true}, "", "expected String but got true"},
+		{"undefined variables", `{ person(name: $n) { name } }`, nil, "", "variable $n is not defined"},
+		{"missing selections", `{ person(name: "alice") }`, nil, "", `field "person" of type "Person" must have a selection of subfields`},
+		{"selections of scalars", `{ person(name: "alice") { name { x } } }`, nil, "", `field "name" must not have a selection since type "String" has no subfields`},
+		{"conflicting aliases", `{ person(name: "alice") { x: name x: age } }`, nil, "", `fields "name" and "age" conflict because they have the same response key "x"`},
+		{"unknown fragments", `{ person(name: "alice") { ...f } }`, nil, "", "unknown fragment: f"},
+		{"unknown directives", `{ person(name: "alice") { name @deprecated } }`, nil, "", "unknown directive: @deprecated"},
+		{"missing directive arguments", `{ person(name: "alice") { name @skip } }`, nil, "", `argument "if" of @skip is required`},
+		{"invalid directive arguments", `{ person(name: "alice") { name @include(if: "yes") } }`, nil, "", `argument "if" of @include: expected Boolean but got yes`},
+	}
+	schema := newTestSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := schema.Execute(context.Background(), &Request{Query: tt.query, OperationName: tt.operation, Variables: tt.variables})
+			if res.Data != nil || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, tt.want) {
+				t.Errorf("Execute() = %+v, want an error containing %q", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	schema := newTestSchema()
+	schema.MaxDepth = 3
+	schema.MaxComplexity = 30
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// depth 3 and complexity 1 + 2 * (1 + 1 + 1 * 1) = 7
+		{`{ people(first: 2) { name friends(first: 1) { name } } }`, ""},
+		{`{ people(first: 2) { friends(first: 1) { friends { name } } } }`, "query depth exceeds the limit 3"},
+		// fragments and inline fragments count for the depth
+		{`{ people { ...f } } fragment f on Person { friends { ... { friends { name } } } }`, "query depth exceeds the limit 3"},
+		// 1 + 10 * (1 + 1 + 1) = 31 by the default list size of 10
+		{`{ people { name age greet } }`, "query complexity exceeds the limit 30"},
+		// 1 + 3 * (1 + 1 + 1 + 1 + 1 + 1 + 1 + 1 + 1) = 28
+		{`{ people(first: 3) { name age greet a: name b: age c: greet d: name e: age f: greet } }`, ""},
+		// aliases are counted separately
+		{`{ a: people(first: 3) { name } b: people(first: 3) { name } c: people(first: 3) { name } d: people(first: 3) { name } }`, ""},
+		{`{ a: people(first: 3) { name } b: people(first: 3) { name } c: people(first: 3) { name } d: people(first: 3) { name } e: people(first: 3) { name } f: people(first: 3) { name } g: people(first: 3) { name } h: people(first: 3) { name } }`, "query complexity exceeds the limit 30"},
+		// skipped fields cost nothing
+		{`{ people { name @skip(if: true) age @skip(if: true) } map { key } }`, ""},
+	}
+	for _, tt := range tests {
+		res := schema.Execute(context.Background(), &Request{Query: tt.query})
+		if tt.want == "" {
+			if res.Data == nil || len(res.Errors) != 0 {
+				t.Errorf("Execute(%q) = %+v, want success", tt.query, res.Errors)
+			}
+			continue
+		}
+		if res.Data != nil || len(res.Errors) != 1 || res.Errors[0].Message != tt.want {
+			t.Errorf("Execute(%q) = %+v, want %q", tt.query, res, tt.want)
+		}
+	}
+}
+
+func TestExecuteComplexityOfDeepLists(t *testing.T) {
+	// 1000000^depth overflows int without saturation
+	query := `{ name }`
+	for i := 0; i < 6; i++ {
+		query = `{ friends(first: 1000000) ` + query + ` }`
+	}
+	query = `{ person(name: "alice") ` + query + ` }`
+	schema := newTestSchema()
+	schema.MaxComplexity = 2000
+	res := schema.Execute(context.Background(), &Request{Query: query})
+	if res.Data != nil || len(res.Errors) != 1 || res.Errors[0].Message != "query complexity exceeds the limit 2000" {
+		t.Errorf("Execute() = %+v, want the complexity limit exceeded", res)
+	}
+	// costs saturate without limits
+	schema.MaxComplexity = 0
+	res = schema.Execute(context.Background(), &Request{Query: query})
+	if res.Data == nil || len(res.Errors) != 0 {
+		t.Errorf("Execute() without limits = %+v, want success", res.Errors)
+	}
+}
+
+func TestAddComplexity(t *testing.T) {
+	tests := []struct {
+		x, y, want int
+	}{
+		{1, 2, 3},
+		{maxComplexity - 1, 1, maxComplexity},
+		{maxComplexity, 1, maxComplexity},
+		{maxComplexity, maxComplexity, maxComplexity},
+		{1, -1, maxComplexity},
+	}
+	for _, tt := range tests {
+		if got := addComplexity(tt.x, tt.y); got != tt.want {
+			t.Errorf("addComplexity(%d, %d) = %d, want %d", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,761 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query (or an unsupported mutation or subscription) of a document
+type Operation struct {
+	Type         string
+	Name         string
+	Variables    []*VariableDefinition
+	SelectionSet []Selection
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    string
+	Default Value
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]Value
+}
+
+// Selection is a *Field, *FragmentSpread or *InlineFragment
+type Selection interface {
+	directives() []*Directive
+}
+
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]Value
+	Directives   []*Directive
+	SelectionSet []Selection
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+}
+
+func (f *Field) directives() []*Directive          { return f.Directives }
+func (f *FragmentSpread) directives() []*Directive { return f.Directives }
+func (f *InlineFragment) directives() []*Directive { return f.Directives }
+
+// ResponseKey is the alias or the name of the field
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Value is a literal: nil, bool, int, float64, string, Enum, Variable, []Value or map[string]Value
+type Value interface{}
+
+type Enum string
+
+type Variable string
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// SyntaxError is an error in a document
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d: %s", e.Pos, e.Message)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || ('0' <= c && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// skipIgnored skips white spaces, line terminators, commas and comments
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (*token, error) {
+	l.skipIgnored()
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return &token{kind: tokenEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		l.pos++
+		return &token{kind: tokenPunct, value: string(c), pos: start}, nil
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return &token{kind: tokenPunct, value: "...", pos: start}, nil
+	case isNameStart(c):
+		for l.pos < len(l.src) && isNameContinue(l.src[l.pos]) {
+			l.pos++
+		}
+		return &token{kind: tokenName, value: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		return l.blockString()
+	case c == '"':
+		return l.string()
+	}
+	return nil, &SyntaxError{Pos: start, Message: fmt.Sprintf("unexpected character %q", c)}
+}
+
+func (l *lexer) digits() int {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.pos - start
+}
+
+func (l *lexer) number() (*token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if l.digits() == 0 {
+		return nil, &SyntaxError{Pos: start, Message: "invalid number"}
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		if l.digits() == 0 {
+			return nil, &SyntaxError{Pos: start, Message: "invalid number"}
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.digits() == 0 {
+			return nil, &SyntaxError{Pos: start, Message: "invalid number"}
+		}
+	}
+	if l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || l.src[l.pos] == '.') {
+		return nil, &SyntaxError{Pos: start, Message: "invalid number"}
+	}
+	return &token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) string() (*token, error) {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return &token{kind: tokenString, value: b.String(), pos: start}, nil
+		case c == '\n' || c == '\r':
+			return nil, &SyntaxError{Pos: l.pos, Message: "unterminated string"}
+		case c == '\\':
+			if l.pos+1 >= len(l.src) {
+				return nil, &SyntaxError{Pos: l.pos, Message: "unterminated string"}
+			}
+			escaped := l.src[l.pos+1]
+			l.pos += 2
+			switch escaped {
+			case '"', '\\', '/':
+				b.WriteByte(escaped)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return nil, &SyntaxError{Pos: l.pos, Message: "invalid unicode escape"}
+				}
+				r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return nil, &SyntaxError{Pos: l.pos, Message: "invalid unicode escape"}
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				return nil, &SyntaxError{Pos: l.pos - 2, Message: fmt.Sprintf("invalid escape \\%c", escaped)}
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			b.WriteRune(r)
+			l.pos += size
+		}
+	}
+	return nil, &SyntaxError{Pos: start, Message: "unterminated string"}
+}
+
+func (l *lexer) blockString() (*token, error) {
+	start := l.pos
+	l.pos += 3
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			l.pos += 3
+			return &token{kind: tokenString, value: blockStringValue(b.String()), pos: start}, nil
+		case strings.HasPrefix(l.src[l.pos:], `\"""`):
+			b.WriteString(`"""`)
+			l.pos += 4
+		default:
+			b.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+	}
+	return nil, &SyntaxError{Pos: start, Message: "unterminated string"}
+}
+
+// blockStringValue removes the common indentation and leading and trailing blank lines
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.Replace(strings.Replace(raw, "\r\n", "\n", -1), "\r", "\n", -1), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type parser struct {
+	lexer *lexer
+	token *token
+}
+
+// Parse parses a request document; type system definitions are not supported
+func Parse(src string) (*Document, error) {
+	p := &parser{lexer: &lexer{src: src}}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", SelectionSet: selections})
+		case p.peek(tokenName, "query") || p.peek(tokenName, "mutation") || p.peek(tokenName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peek(tokenName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if doc.Fragments[fragment.Name] != nil {
+				return nil, fmt.Errorf("duplicate fragment: %s", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("no operations")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	t, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = t
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == tokenEOF {
+		return &SyntaxError{Pos: p.token.pos, Message: "unexpected end of document"}
+	}
+	return &SyntaxError{Pos: p.token.pos, Message: fmt.Sprintf("unexpected %q", p.token.value)}
+}
+
+// skip consumes the punctuator if present
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(tokenPunct, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(value string) error {
+	if !p.peek(tokenPunct, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.token.value}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind == tokenName {
+		op.Name = p.token.value
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(tokenPunct, ")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = append(op.Variables, def)
+		}
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// directives of operations have no effect
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	op.SelectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*VariableDefinition, error) {
+	err := p.expect("$")
+	if err != nil {
+		return nil, err
+	}
+	def := &VariableDefinition{}
+	def.Name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect(":")
+	if err != nil {
+		return nil, err
+	}
+	def.Type, err = p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		def.Default, err = p.value(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return def, nil
+}
+
+// typeRef parses a type reference (e.g. "[String!]!") which is kept as text
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if ok, err := p.skip("["); err != nil {
+		return "", err
+	} else if ok {
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		err = p.expect("]")
+		if err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if ok, err := p.skip("!"); err != nil {
+		return "", err
+	} else if ok {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	fragment := &Fragment{}
+	fragment.Name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, &SyntaxError{Pos: p.token.pos, Message: "fragment cannot be named \"on\""}
+	}
+	if !p.peek(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	err = p.advance()
+	if err != nil {
+		return nil, err
+	}
+	fragment.TypeCondition, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	fragment.SelectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	err := p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	selections := make([]Selection, 0)
+	for !p.peek(tokenPunct, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, &SyntaxError{Pos: p.token.pos, Message: "empty selection set"}
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (Selection, error) {
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if !ok {
+		return p.field()
+	}
+	if p.token.kind == tokenName && p.token.value != "on" {
+		spread := &FragmentSpread{Name: p.token.value}
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		spread.Directives, err = p.directives()
+		if err != nil {
+			return nil, err
+		}
+		return spread, nil
+	}
+	fragment := &InlineFragment{}
+	if p.peek(tokenName, "on") {
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		fragment.TypeCondition, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	fragment.Directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	fragment.SelectionSet, err = p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *parser) field() (*Field, error) {
+	f := &Field{}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.Alias = name
+		name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.Name = name
+	f.Arguments, err = p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	f.Directives, err = p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek(tokenPunct, "{") {
+		f.SelectionSet, err = p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) arguments() (map[string]Value, error) {
+	args := make(map[string]Value)
+	if ok, err := p.skip("("); err != nil || !ok {
+		return args, err
+	}
+	for !p.peek(tokenPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, fmt.Errorf("duplicate argument: %s", name)
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		args[name], err = p.value(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var directives []*Directive
+	for p.peek(tokenPunct, "@") {
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		directive := &Directive{}
+		directive.Name, err = p.name()
+		if err != nil {
+			return nil, err
+		}
+		directive.Arguments, err = p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value parses a literal; variables are not allowed in constant values (e.g. defaults of variables)
+func (p *parser) value(constant bool) (Value, error) {
+	t := p.token
+	switch t.kind {
+	case tokenInt:
+		n, err := strconv.Atoi(t.value)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Message: "integer out of range"}
+		}
+		return n, p.advance()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Message: "invalid float"}
+		}
+		return f, p.advance()
+	case tokenString:
+		return t.value, p.advance()
+	case tokenName:
+		var v Value
+		switch t.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = Enum(t.value)
+		}
+		return v, p.advance()
+	}
+	switch {
+	case t.value == "$" && !constant:
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return Variable(name), nil
+	case t.value == "[":
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		list := make([]Value, 0)
+		for !p.peek(tokenPunct, "]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case t.value == "{":
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		obj := make(map[string]Value)
+		for !p.peek(tokenPunct, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect(":")
+			if err != nil {
+				return nil, err
+			}
+			obj[name], err = p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	}
+	return nil, p.unexpected()
+}
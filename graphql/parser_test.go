@@ -0,0 +1,171 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `
+# comments, commas and the BOM are ignored
+query Repo($name: String! = "gitan", $first: [Int!]) @cached {
+	alias: repo(name: $name, user: USER) {
+		log(first: 10) @include(if: true) { id }
+		...repoFields
+		... on Repo { name }
+		... @skip(if: $skip) { description }
+	}
+}
+
+fragment repoFields on Repo { name, tags { name } }
+
+{ __typename }
+`
+	want := &Document{
+		Operations: []*Operation{
+			{
+				Type: "query",
+				Name: "Repo",
+				Variables: []*VariableDefinition{
+					{Name: "name", Type: "String!", Default: "gitan"},
+					{Name: "first", Type: "[Int!]"},
+				},
+				SelectionSet: []Selection{
+					&Field{
+						Alias:     "alias",
+						Name:      "repo",
+						Arguments: map[string]Value{"name": Variable("name"), "user": Enum("USER")},
+						SelectionSet: []Selection{
+							&Field{
+								Name:         "log",
+								Arguments:    map[string]Value{"first": 10},
+								Directives:   []*Directive{{Name: "include", Arguments: map[string]Value{"if": true}}},
+								SelectionSet: []Selection{&Field{Name: "id", Arguments: map[string]Value{}}},
+							},
+							&FragmentSpread{Name: "repoFields"},
+							&InlineFragment{
+								TypeCondition: "Repo",
+								SelectionSet:  []Selection{&Field{Name: "name", Arguments: map[string]Value{}}},
+							},
+							&InlineFragment{
+								Directives:   []*Directive{{Name: "skip", Arguments: map[string]Value{"if": Variable("skip")}}},
+								SelectionSet: []Selection{&Field{Name: "description", Arguments: map[string]Value{}}},
+							},
+						},
+					},
+				},
+			},
+			{
+				Type:         "query",
+				SelectionSet: []Selection{&Field{Name: "__typename", Arguments: map[string]Value{}}},
+			},
+		},
+		Fragments: map[string]*Fragment{
+			"repoFields": {
+				Name:          "repoFields",
+				TypeCondition: "Repo",
+				SelectionSet: []Selection{
+					&Field{Name: "name", Arguments: map[string]Value{}},
+					&Field{
+						Name:         "tags",
+						Arguments:    map[string]Value{},
+						SelectionSet: []Selection{&Field{Name: "name", Arguments: map[string]Value{}}},
+					},
+				},
+			},
+		},
+	}
+	doc, err := Parse("\uFEFF" + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("Parse() = %#v, want %#v", doc, want)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Value
+	}{
+		{`0`, 0},
+		{`-42`, -42},
+		{`1.5`, 1.5},
+		{`-1e3`, -1000.0},
+		{`2.5E-1`, 0.25},
+		{`true`, true},
+		{`false`, false},
+		{`null`, nil},
+		{`ENUM_VALUE`, Enum("ENUM_VALUE")},
+		{`$var`, Variable("var")},
+		{`""`, ""},
+		{`"a\"b\\c\/d\n\t"`, "a\"b\\c/d\n\t"},
+		{`"éあ"`, "éあ"},
+		{`"""
+			block
+			  indented
+		"""`, "block\n  indented"},
+		{`"""a \""" b"""`, `a """ b`},
+		{`[]`, []Value{}},
+		{`[1, "a", [true]]`, []Value{1, "a", []Value{true}}},
+		{`{a: 1, b: {c: $v}}`, map[string]Value{"a": 1, "b": map[string]Value{"c": Variable("v")}}},
+	}
+	for _, tt := range tests {
+		doc, err := Parse(`{ f(v: ` + tt.src + `) }`)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		got := doc.Operations[0].SelectionSet[0].(*Field).Arguments["v"]
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "no operations"},
+		{`# only comments`, "no operations"},
+		{`{`, "unexpected end of document"},
+		{`{}`, "empty selection set"},
+		{`{ a } }`, `unexpected "}"`},
+		{`{ a(b: 1, b: 2) }`, "duplicate argument: b"},
+		{`{ a(b: 01x) }`, "invalid number"},
+		{`{ a(b: 1.) }`, "invalid number"},
+		{`{ a(b: -) }`, "invalid number"},
+		{`{ a(b: 99999999999999999999) }`, "integer out of range"},
+		{`{ a(b: "abc) }`, "unterminated string"},
+		{"{ a(b: \"a\nb\") }", "unterminated string"},
+		{`{ a(b: """abc) }`, "unterminated string"},
+		{`{ a(b: "\x") }`, `invalid escape \x`},
+		{`{ a(b: "\u12") }`, "invalid unicode escape"},
+		{`{ a(b: ?) }`, "unexpected character '?'"},
+		{`query($a: Int = $b) { a }`, `unexpected "$"`},
+		{`query($a Int) { a }`, `unexpected "Int"`},
+		{`query { a } fragment f on T { a } fragment f on T { b }`, "duplicate fragment: f"},
+		{`fragment on on T { a }`, `fragment cannot be named "on"`},
+		{`fragment f T { a }`, `unexpected "T"`},
+		{`{ ...f @ }`, `unexpected "}"`},
+		{`type Query { a: Int }`, `unexpected "type"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := Parse("{\n  a(b: ?)\n}")
+	serr, ok := err.(*SyntaxError)
+	if !ok || serr.Pos != 9 {
+		t.Errorf("Parse() = %#v, want a syntax error at 9", err)
+	}
+}
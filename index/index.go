@@ -0,0 +1,350 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/taskie/gitan/repo"
+)
+
+const (
+	shardVersion = 1
+	// MaxFileSize is the largest blob to be indexed
+	MaxFileSize     = 1 << 20
+	maxLinesPerFile = 10
+	// MinQueryLength is the length of the shortest query, which has at least one trigram
+	MinQueryLength = 3
+)
+
+// RepoKey identifies a repository registered in the server
+type RepoKey struct {
+	Site string `json:"site"`
+	User string `json:"user"`
+	Repo string `json:"repo"`
+}
+
+func (k RepoKey) fileName() string {
+	return url.PathEscape(k.Site) + "," + url.PathEscape(k.User) + "," + url.PathEscape(k.Repo) + ".gob"
+}
+
+type fileEntry struct {
+	Path   string
+	BlobID string
+}
+
+// shardData is the on-disk representation of an indexed repository
+type shardData struct {
+	Version  int
+	CommitID string
+	Files    []*fileEntry
+	// Trigrams holds sorted trigrams of lower-cased contents per blob
+	Trigrams map[string][]uint32
+}
+
+type shard struct {
+	data     *shardData
+	postings map[uint32][]int
+	repo     *repo.Repo
+}
+
+func newShard(data *shardData, r *repo.Repo) *shard {
+	postings := make(map[uint32][]int)
+	for i, f := range data.Files {
+		for _, tri := range data.Trigrams[f.BlobID] {
+			postings[tri] = append(postings[tri], i)
+		}
+	}
+	return &shard{
+		data:     data,
+		postings: postings,
+		repo:     r,
+	}
+}
+
+// Index is a trigram index of the default branch of repositories stored on local disk
+type Index struct {
+	dir    string
+	mutex  sync.RWMutex
+	shards map[RepoKey]*shard
+}
+
+// NewIndex creates an index persisted in dir
+func NewIndex(dir string) (*Index, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating index directory failed: %s", dir)
+	}
+	return &Index{
+		dir:    dir,
+		shards: make(map[RepoKey]*shard),
+	}, nil
+}
+
+func (ix *Index) loadShardData(key RepoKey) *shardData {
+	f, err := os.Open(filepath.Join(ix.dir, key.fileName()))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var data shardData
+	err = gob.NewDecoder(f).Decode(&data)
+	if err != nil || data.Version != shardVersion {
+		return nil
+	}
+	return &data
+}
+
+func (ix *Index) saveShardData(key RepoKey, data *shardData) error {
+	path := filepath.Join(ix.dir, key.fileName())
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Update indexes rev (usually the default branch) of the repository unless it is already indexed.
+// Trigrams of blobs which were indexed at the previous commit are reused.
+func (ix *Index) Update(key RepoKey, r *repo.Repo, rev string) error {
+	ix.mutex.RLock()
+	old := ix.shards[key]
+	ix.mutex.RUnlock()
+	var oldData *shardData
+	if old != nil {
+		oldData = old.data
+	} else {
+		oldData = ix.loadShardData(key)
+	}
+	cis, err := r.GetLog(rev, 1)
+	if err != nil {
+		return err
+	}
+	ci := cis[0]
+	if oldData != nil && oldData.CommitID == ci.ID {
+		if old == nil {
+			ix.mutex.Lock()
+			ix.shards[key] = newShard(oldData, r)
+			ix.mutex.Unlock()
+		}
+		return nil
+	}
+	tes, err := r.Find("", ci.ID, 0)
+	if err != nil {
+		return err
+	}
+	data := &shardData{
+		Version:  shardVersion,
+		CommitID: ci.ID,
+		Files:    make([]*fileEntry, 0),
+		Trigrams: make(map[string][]uint32),
+	}
+	reused := 0
+	for _, te := range tes {
+		if !te.Kind.IsFile() {
+			continue
+		}
+		if _, ok := data.Trigrams[te.Hash]; !ok {
+			if oldData != nil && oldData.Trigrams[te.Hash] != nil {
+				data.Trigrams[te.Hash] = oldData.Trigrams[te.Hash]
+				reused++
+			} else {
+				bs, err := r.GetListedBlob(te.Hash)
+				if err != nil {
+					return err
+				}
+				if len(bs) > MaxFileSize || isBinary(bs) {
+					continue
+				}
+				data.Trigrams[te.Hash] = trigrams(bytes.ToLower(bs))
+			}
+		}
+		data.Files = append(data.Files, &fileEntry{Path: te.Name, BlobID: te.Hash})
+	}
+	err = ix.saveShardData(key, data)
+	if err != nil {
+		return errors.Wrap(err, "saving index failed")
+	}
+	log.Infof("indexed %s/%s/%s at %s (%d files, %d reused)", key.Site, key.User, key.Repo, ci.ID, len(data.Files), reused)
+	ix.mutex.Lock()
+	ix.shards[key] = newShard(data, r)
+	ix.mutex.Unlock()
+	return nil
+}
+
+func isBinary(bs []byte) bool {
+	if len(bs) > repo.BinaryCheckSize {
+		bs = bs[:repo.BinaryCheckSize]
+	}
+	return bytes.IndexByte(bs, 0) >= 0
+}
+
+func trigrams(bs []byte) []uint32 {
+	set := make(map[uint32]struct{})
+	for i := 0; i+3 <= len(bs); i++ {
+		set[uint32(bs[i])<<16|uint32(bs[i+1])<<8|uint32(bs[i+2])] = struct{}{}
+	}
+	tris := make([]uint32, 0, len(set))
+	for tri := range set {
+		tris = append(tris, tri)
+	}
+	sort.Slice(tris, func(i, j int) bool { return tris[i] < tris[j] })
+	return tris
+}
+
+// Query describes a literal search over indexed repositories; empty fields of RepoKey match everything
+type Query struct {
+	RepoKey
+	Text            string
+	CaseInsensitive bool
+	MaxResults      int
+}
+
+type LineMatch struct {
+	LineNumber int    `json:"line_number"`
+	Line       string `json:"line"`
+}
+
+type Result struct {
+	RepoKey
+	CommitID string       `json:"commit_id"`
+	Path     string       `json:"path"`
+	Score    int          `json:"score"`
+	Matches  []*LineMatch `json:"matches"`
+}
+
+func (q *Query) matchesKey(key RepoKey) bool {
+	return (q.Site == "" || q.Site == key.Site) &&
+		(q.User == "" || q.User == key.User) &&
+		(q.Repo == "" || q.Repo == key.Repo)
+}
+
+func (s *shard) candidates(text string) []int {
+	var result []int
+	for i, tri := range trigrams([]byte(strings.ToLower(text))) {
+		posting := s.postings[tri]
+		if i == 0 {
+			result = posting
+			continue
+		}
+		result = intersect(result, posting)
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+func intersect(xs []int, ys []int) []int {
+	result := make([]int, 0)
+	for i, j := 0, 0; i < len(xs) && j < len(ys); {
+		switch {
+		case xs[i] < ys[j]:
+			i++
+		case xs[i] > ys[j]:
+			j++
+		default:
+			result = append(result, xs[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Search finds files containing the query text, ordered by score
+func (ix *Index) Search(q *Query) ([]*Result, error) {
+	if q.Text == "" {
+		return nil, errors.New("empty query")
+	}
+	// shorter queries have no trigrams and would scan every blob
+	if len(q.Text) < MinQueryLength {
+		return nil, errors.Errorf("query must be at least %d bytes", MinQueryLength)
+	}
+	needle := q.Text
+	if q.CaseInsensitive {
+		needle = strings.ToLower(needle)
+	}
+	// blobs are read after releasing the lock not to block updates while reading them
+	type candidate struct {
+		key   RepoKey
+		shard *shard
+		file  *fileEntry
+	}
+	candidates := make([]*candidate, 0)
+	ix.mutex.RLock()
+	for key, s := range ix.shards {
+		if !q.matchesKey(key) {
+			continue
+		}
+		for _, i := range s.candidates(q.Text) {
+			candidates = append(candidates, &candidate{key: key, shard: s, file: s.data.Files[i]})
+		}
+	}
+	ix.mutex.RUnlock()
+	results := make([]*Result, 0)
+	for _, cand := range candidates {
+		f := cand.file
+		bs, err := cand.shard.repo.GetListedBlob(f.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		result := &Result{
+			RepoKey:  cand.key,
+			CommitID: cand.shard.data.CommitID,
+			Path:     f.Path,
+			Matches:  make([]*LineMatch, 0),
+		}
+		for n, line := range strings.Split(string(bs), "\n") {
+			haystack := line
+			if q.CaseInsensitive {
+				haystack = strings.ToLower(haystack)
+			}
+			count := strings.Count(haystack, needle)
+			if count == 0 {
+				continue
+			}
+			result.Score += count
+			if len(result.Matches) < maxLinesPerFile {
+				result.Matches = append(result.Matches, &LineMatch{LineNumber: n + 1, Line: line})
+			}
+		}
+		if result.Score == 0 {
+			continue
+		}
+		if strings.Contains(strings.ToLower(f.Path), strings.ToLower(q.Text)) {
+			result.Score += 10
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		ki, kj := results[i].RepoKey, results[j].RepoKey
+		if ki != kj {
+			return ki.fileName() < kj.fileName()
+		}
+		return results[i].Path < results[j].Path
+	})
+	if q.MaxResults > 0 && len(results) > q.MaxResults {
+		results = results[:q.MaxResults]
+	}
+	return results, nil
+}
@@ -0,0 +1,259 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskie/gitan/repo"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// testRepo commits files to the master branch of a repo on memory storage
+type testRepo struct {
+	t          *testing.T
+	repository *git.Repository
+	worktree   *git.Worktree
+	now        time.Time
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	repository, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, repository: repository, worktree: worktree, now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (tr *testRepo) commit(files map[string]string) string {
+	for path, contents := range files {
+		f, err := tr.worktree.Filesystem.Create(path)
+		if err == nil {
+			_, err = f.Write([]byte(contents))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			_, err = tr.worktree.Add(path)
+		}
+		if err != nil {
+			tr.t.Fatal(err)
+		}
+	}
+	tr.now = tr.now.Add(time.Minute)
+	h, err := tr.worktree.Commit("commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: tr.now},
+	})
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	return h.String()
+}
+
+func (tr *testRepo) open() *repo.Repo {
+	return repo.NewRepoWithRepository(tr.repository)
+}
+
+func newTestIndex(t *testing.T) (*Index, string) {
+	dir, err := ioutil.TempDir("", "gitan-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIndex(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return ix, dir
+}
+
+func blobID(t *testing.T, data *shardData, path string) string {
+	for _, f := range data.Files {
+		if f.Path == path {
+			return f.BlobID
+		}
+	}
+	t.Fatalf("%s is not indexed", path)
+	return ""
+}
+
+func TestUpdateReusesShards(t *testing.T) {
+	ix, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+	key := RepoKey{Site: "s", User: "u", Repo: "r/x"}
+	tr := newTestRepo(t)
+	first := tr.commit(map[string]string{"a.txt": "alpha", "b.txt": "bravo", "bin": "\x00\x01\x02"})
+	r := tr.open()
+	err := ix.Update(key, r, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := ix.shards[key].data
+	if data.CommitID != first || len(data.Files) != 2 {
+		t.Fatalf("shard = %+v, want 2 text files at %s", data, first)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "s,u,r%2Fx.gob")); err != nil {
+		t.Errorf("shard is not persisted: %v", err)
+	}
+
+	// trigrams are taken from the saved shard instead of the blobs if the commit is already indexed
+	sentinel := []uint32{1, 2, 3}
+	data.Trigrams[blobID(t, data, "a.txt")] = sentinel
+	err = ix.saveShardData(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reopened.Update(key, r, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := reopened.shards[key].data
+	if loaded.CommitID != first || !reflect.DeepEqual(loaded.Trigrams[blobID(t, loaded, "a.txt")], sentinel) {
+		t.Errorf("shard = %+v, want the saved one", loaded)
+	}
+
+	// trigrams of unchanged blobs are reused for new commits
+	second := tr.commit(map[string]string{"b.txt": "bravo charlie"})
+	err = reopened.Update(key, r, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := reopened.shards[key].data
+	if updated.CommitID != second || len(updated.Files) != 2 {
+		t.Fatalf("shard = %+v, want 2 text files at %s", updated, second)
+	}
+	if !reflect.DeepEqual(updated.Trigrams[blobID(t, updated, "a.txt")], sentinel) {
+		t.Errorf("trigrams of the unchanged blob are not reused: %v", updated.Trigrams[blobID(t, updated, "a.txt")])
+	}
+	if !reflect.DeepEqual(updated.Trigrams[blobID(t, updated, "b.txt")], trigrams([]byte("bravo charlie"))) {
+		t.Errorf("trigrams of the changed blob are not computed: %v", updated.Trigrams[blobID(t, updated, "b.txt")])
+	}
+}
+
+func TestUpdateIgnoresShardsOfOtherVersions(t *testing.T) {
+	ix, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+	key := RepoKey{Site: "s", User: "u", Repo: "r"}
+	tr := newTestRepo(t)
+	id := tr.commit(map[string]string{"a.txt": "alpha"})
+	err := ix.saveShardData(key, &shardData{Version: shardVersion + 1, CommitID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reopened.Update(key, tr.open(), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := reopened.shards[key].data; data.Version != shardVersion || len(data.Files) != 1 {
+		t.Errorf("shard = %+v, want a reindexed one", data)
+	}
+}
+
+func paths(results []*Result) []string {
+	ps := make([]string, 0, len(results))
+	for _, result := range results {
+		ps = append(ps, result.Repo+":"+result.Path)
+	}
+	return ps
+}
+
+func TestSearch(t *testing.T) {
+	ix, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+	tr1 := newTestRepo(t)
+	tr1.commit(map[string]string{
+		"one.txt":   "hello world",
+		"three.txt": "hello hello\nhello",
+		"upper.txt": "HELLO",
+		"other.txt": "goodbye",
+	})
+	tr2 := newTestRepo(t)
+	tr2.commit(map[string]string{
+		"hello.txt": "hello",
+		"lines.txt": strings.Repeat("hello\n", 20),
+	})
+	for key, tr := range map[RepoKey]*testRepo{
+		{Site: "s", User: "u", Repo: "r1"}: tr1,
+		{Site: "s", User: "u", Repo: "r2"}: tr2,
+	} {
+		err := ix.Update(key, tr.open(), "master")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query *Query
+		want  []string
+	}{
+		{"ranking", &Query{Text: "hello"},
+			// 20 occurrences, 1 occurrence and 10 for the path, 3 occurrences, ...
+			[]string{"r2:lines.txt", "r2:hello.txt", "r1:three.txt", "r1:one.txt"}},
+		{"case folding", &Query{Text: "hello", CaseInsensitive: true},
+			[]string{"r2:lines.txt", "r2:hello.txt", "r1:three.txt", "r1:one.txt", "r1:upper.txt"}},
+		{"case folding of the query", &Query{Text: "HELLO", CaseInsensitive: true},
+			[]string{"r2:lines.txt", "r2:hello.txt", "r1:three.txt", "r1:one.txt", "r1:upper.txt"}},
+		{"case sensitive", &Query{Text: "HELLO"}, []string{"r1:upper.txt"}},
+		{"repo", &Query{RepoKey: RepoKey{Repo: "r1"}, Text: "hello"}, []string{"r1:three.txt", "r1:one.txt"}},
+		{"max results", &Query{Text: "hello", MaxResults: 2}, []string{"r2:lines.txt", "r2:hello.txt"}},
+		{"no match", &Query{Text: "xyz"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := ix.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	results, err := ix.Search(&Query{Text: "hello", RepoKey: RepoKey{Repo: "r2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Score != 20 || len(results[0].Matches) != maxLinesPerFile || results[0].Matches[0].LineNumber != 1 {
+		t.Errorf("Search()[0] = %+v", results[0])
+	}
+	if results[1].Score != 11 {
+		t.Errorf("score of the matching path = %d, want 11", results[1].Score)
+	}
+}
+
+func TestSearchRejectsShortQueries(t *testing.T) {
+	ix, dir := newTestIndex(t)
+	defer os.RemoveAll(dir)
+	for _, text := range []string{"", "a", "ab"} {
+		_, err := ix.Search(&Query{Text: text})
+		if err == nil {
+			t.Errorf("Search(%q) succeeded, want an error", text)
+		}
+	}
+	_, err := ix.Search(&Query{Text: strings.Repeat("a", MinQueryLength)})
+	if err != nil {
+		t.Errorf("Search() of %d bytes: %v", MinQueryLength, err)
+	}
+}
@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// BinaryCheckSize is the length of the prefix scanned for NUL bytes to detect binary files (same as git)
+const BinaryCheckSize = 8000
+
+// Backend reads trees, files and history of a repository.
+// Revisions are resolved by Repo beforehand, so every method takes commit hashes.
+type Backend interface {
+	// Tree lists the directory at path in the commit
+	Tree(commit plumbing.Hash, path string) ([]*TreeEntry, error)
+	// File returns the file at path in the commit
+	File(commit plumbing.Hash, path string) (FileOpener, *FileStat, error)
+	// Blob returns the blob of hash
+	Blob(hash plumbing.Hash) (FileOpener, error)
+	// Log returns at most limit commits (or all if limit is 0) reachable from the commit ordered by committer time
+	Log(from plumbing.Hash, limit int) ([]plumbing.Hash, error)
+}
+
+// SetBackend replaces the backend of the repo; nil restores the go-git one.
+// Processes of the git CLI backend of a lazy repo are stopped when the repo is evicted from the pool.
+func (r *Repo) SetBackend(b Backend) {
+	r.backend = b
+	if cli, ok := b.(*gitCLIBackend); ok && r.pool != nil {
+		cli.setOnStart(func() error { return r.pool.Attach(r.path, cli) })
+	}
+}
+
+func (r *Repo) getBackend() Backend {
+	if r.backend != nil {
+		return r.backend
+	}
+	return goGitBackend{r: r}
+}
+
+// newFileStat creates FileStat from the first BinaryCheckSize bytes (or more) of contents
+func newFileStat(hash plumbing.Hash, name string, mode filemode.FileMode, size int64, head []byte) *FileStat {
+	if len(head) > BinaryCheckSize {
+		head = head[:BinaryCheckSize]
+	}
+	isBinary := bytes.IndexByte(head, 0) >= 0
+	stat := &FileStat{
+		ID:       hash.String(),
+		Name:     name,
+		Mode:     NewMode(mode),
+		Size:     size,
+		IsBinary: isBinary,
+	}
+	if !isBinary && size <= lfsPointerMaxSize {
+		if pointer := ParseLFSPointer(head); pointer != nil {
+			stat.LFSOID = pointer.OID
+			stat.LFSSize = pointer.Size
+		}
+	}
+	return stat
+}
+
+// goGitBackend reads objects with go-git
+type goGitBackend struct {
+	r *Repo
+}
+
+func (b goGitBackend) Tree(commit plumbing.Hash, path string) ([]*TreeEntry, error) {
+	repository, err := b.r.open()
+	if err != nil {
+		return nil, err
+	}
+	ci, err := repository.CommitObject(commit)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining commit failed")
+	}
+	tree, err := ci.Tree()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining tree from commit failed")
+	}
+	if path != "" {
+		tree, err = tree.Tree(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "obtaining file or directory failed")
+		}
+	}
+	results := make([]*TreeEntry, 0)
+	for _, te := range tree.Entries {
+		result, err := NewTreeEntry(&te)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid tree entry")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (b goGitBackend) File(commit plumbing.Hash, path string) (FileOpener, *FileStat, error) {
+	repository, err := b.r.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	ci, err := repository.CommitObject(commit)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "obtaining commit failed")
+	}
+	file, err := ci.File(path)
+	if err != nil {
+		tree, err := ci.Tree()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "obtaining tree from commit failed")
+		} else {
+			_, err := tree.Tree(path)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "obtaining file or directory failed")
+			} else {
+				return nil, nil, errors.New("obtaining directory")
+			}
+		}
+	}
+	fileOpener := func() (io.ReadCloser, error) {
+		r, err := file.Reader()
+		if err != nil {
+			return nil, errors.Wrap(err, "opening file failed")
+		}
+		return r, nil
+	}
+	fileStat, err := NewFileStat(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fileOpener, fileStat, nil
+}
+
+func (b goGitBackend) Blob(hash plumbing.Hash) (FileOpener, error) {
+	repository, err := b.r.open()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := repository.BlobObject(hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining blob object failed")
+	}
+	return func() (io.ReadCloser, error) { return blob.Reader() }, nil
+}
+
+func (b goGitBackend) Log(from plumbing.Hash, limit int) ([]plumbing.Hash, error) {
+	repository, err := b.r.open()
+	if err != nil {
+		return nil, err
+	}
+	node, err := b.r.commitNodeIndex(repository).Get(from)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining commit failed")
+	}
+	nodeIter := commitgraph.NewCommitNodeIterCTime(node, nil, nil)
+	defer nodeIter.Close()
+	hashes := make([]plumbing.Hash, 0)
+	err = nodeIter.ForEach(func(node commitgraph.CommitNode) error {
+		if limit > 0 && len(hashes) >= limit {
+			return storer.ErrStop
+		}
+		hashes = append(hashes, node.ID())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
@@ -0,0 +1,213 @@
+package repo
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultCacheSize is the default size of the in-memory cache in bytes
+	DefaultCacheSize = 64 << 20
+	// DefaultRefTTL is the default lifetime of ref resolution results
+	DefaultRefTTL = 5 * time.Second
+)
+
+type cacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// Cache is a size-bounded LRU cache of encoded values, optionally backed by a directory.
+// Values are keyed by object hashes so they never need invalidation,
+// except for ref resolution results which expire after the ref TTL.
+// A nil *Cache is valid and caches nothing.
+type Cache struct {
+	maxSize int64
+	dir     string
+	refTTL  time.Duration
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewCache creates a cache holding at most maxSize bytes in memory; values are also persisted in dir unless it is empty
+func NewCache(maxSize int64, dir string, refTTL time.Duration) (*Cache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	if refTTL <= 0 {
+		refTTL = DefaultRefTTL
+	}
+	if dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating cache directory failed: %s", dir)
+		}
+	}
+	return &Cache{
+		maxSize: maxSize,
+		dir:     dir,
+		refTTL:  refTTL,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}, nil
+}
+
+func (c *Cache) getMemory(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem := c.entries[key]
+	if elem == nil {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.data, true
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.key) + len(entry.data))
+}
+
+func (c *Cache) putMemory(key string, data []byte, ttl time.Duration) {
+	size := int64(len(key) + len(data))
+	if size > c.maxSize {
+		return
+	}
+	entry := &cacheEntry{key: key, data: data}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem := c.entries[key]; elem != nil {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) filePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name[2:])
+}
+
+func (c *Cache) getDisk(key string) ([]byte, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.filePath(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *Cache) putDisk(key string, data []byte) {
+	if c.dir == "" {
+		return
+	}
+	path := c.filePath(key)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		tmpPath := path + ".tmp"
+		err = ioutil.WriteFile(tmpPath, data, 0644)
+		if err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+	}
+	if err != nil {
+		log.Warnf("writing cache failed: %s", err)
+	}
+}
+
+// Get decodes the value of key into v and reports whether it was found
+func (c *Cache) Get(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	data, ok := c.getMemory(key)
+	if !ok {
+		data, ok = c.getDisk(key)
+		if !ok {
+			return false
+		}
+		c.putMemory(key, data, 0)
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v) == nil
+}
+
+// Put stores the immutable value v in memory and on disk
+func (c *Cache) Put(key string, v interface{}) {
+	if c == nil {
+		return
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		log.Warnf("encoding cache entry failed: %s", err)
+		return
+	}
+	c.putMemory(key, buf.Bytes(), 0)
+	c.putDisk(key, buf.Bytes())
+}
+
+// GetBytes returns raw data stored by PutBytes
+func (c *Cache) GetBytes(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return c.getMemory(key)
+}
+
+// PutBytes stores raw data in memory only (e.g. rendered responses which depend on the configuration)
+func (c *Cache) PutBytes(key string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.putMemory(key, data, 0)
+}
+
+func (c *Cache) getRef(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	data, ok := c.getMemory(key)
+	return string(data), ok
+}
+
+func (c *Cache) putRef(key string, hash string) {
+	if c == nil {
+		return
+	}
+	c.putMemory(key, []byte(hash), c.refTTL)
+}
+
+// SetCache enables caching of resolved revisions, trees and commits of the repo
+func (r *Repo) SetCache(cache *Cache) {
+	r.cache = cache
+}
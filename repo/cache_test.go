@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheOfReposOnMemory(t *testing.T) {
+	cache, err := NewCache(0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := make([]*Repo, 0)
+	commits := make([]string, 0)
+	for _, contents := range []string{"a", "b"} {
+		tr := newTestRepo(t)
+		h := tr.commit(contents, map[string]testFile{"file.txt": regular(contents)})
+		tr.setRef("refs/heads/master", h)
+		r := tr.open()
+		r.SetCache(cache)
+		repos = append(repos, r)
+		commits = append(commits, h.String())
+	}
+	if repos[0].Path() != repos[1].Path() {
+		t.Fatal("repos on memory storage are expected to share the empty path")
+	}
+	// resolve twice so that the second one is served from the cache
+	for i := 0; i < 2; i++ {
+		for j, r := range repos {
+			got, err := r.GetCommitHash("master")
+			if err != nil || got != commits[j] {
+				t.Errorf("GetCommitHash() of repo %d = %q, %v, want %s", j, got, err, commits[j])
+			}
+			bs, _, err := r.GetFile("file.txt", "master")
+			if want := []string{"a", "b"}[j]; err != nil || string(bs) != want {
+				t.Errorf("GetFile() of repo %d = %q, %v, want %q", j, bs, err, want)
+			}
+		}
+	}
+}
+
+func TestCacheExpiresRefs(t *testing.T) {
+	ttl := 50 * time.Millisecond
+	cache, err := NewCache(0, "", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.putRef("ref", "a")
+	cache.Put("object", "b")
+	if got, ok := cache.getRef("ref"); !ok || got != "a" {
+		t.Errorf("getRef() = %q, %v, want a", got, ok)
+	}
+	time.Sleep(2 * ttl)
+	if got, ok := cache.getRef("ref"); ok {
+		t.Errorf("getRef() after the TTL = %q, want expired", got)
+	}
+	var v string
+	if !cache.Get("object", &v) || v != "b" {
+		t.Errorf("Get() after the TTL = %q, want b", v)
+	}
+
+	// moved refs are resolved again after the TTL
+	tr := newTestRepo(t)
+	c1 := tr.commit("c1", map[string]testFile{"a.txt": regular("1")})
+	c2 := tr.commit("c2", map[string]testFile{"a.txt": regular("2")}, c1)
+	tr.setRef("refs/heads/master", c1)
+	r := tr.open()
+	r.SetCache(cache)
+	if got, err := r.GetCommitHash("master"); err != nil || got != c1.String() {
+		t.Errorf("GetCommitHash() = %q, %v, want %s", got, err, c1)
+	}
+	tr.setRef("refs/heads/master", c2)
+	if got, err := r.GetCommitHash("master"); err != nil || got != c1.String() {
+		t.Errorf("GetCommitHash() within the TTL = %q, %v, want cached %s", got, err, c1)
+	}
+	time.Sleep(2 * ttl)
+	if got, err := r.GetCommitHash("master"); err != nil || got != c2.String() {
+		t.Errorf("GetCommitHash() after the TTL = %q, %v, want %s", got, err, c2)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewCache(50, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.PutBytes("a", make([]byte, 20))
+	cache.PutBytes("b", make([]byte, 20))
+	if _, ok := cache.GetBytes("a"); !ok {
+		t.Fatal("GetBytes(a) missed")
+	}
+	cache.PutBytes("c", make([]byte, 20))
+	if _, ok := cache.GetBytes("b"); ok {
+		t.Error("GetBytes(b) hit, want evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.GetBytes(key); !ok {
+			t.Errorf("GetBytes(%s) missed", key)
+		}
+	}
+	cache.PutBytes("large", make([]byte, 100))
+	if _, ok := cache.GetBytes("large"); ok {
+		t.Error("GetBytes(large) hit, want values larger than the cache skipped")
+	}
+}
@@ -0,0 +1,267 @@
+package repo
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	graphfmt "gopkg.in/src-d/go-git.v4/plumbing/format/commitgraph"
+	"gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+)
+
+// gitCommitGraphFile is the commit-graph written by `git commit-graph write` (split graphs are not supported)
+const gitCommitGraphFile = "objects/info/commit-graph"
+
+type loadedCommitGraph struct {
+	modTime time.Time
+	index   graphfmt.Index
+}
+
+// SetCommitGraphPath sets the file where UpdateCommitGraph persists gitan's own commit graph
+func (r *Repo) SetCommitGraphPath(path string) {
+	r.commitGraphPath = path
+}
+
+// loadCommitGraph returns the commit graph at path, reopening it when the file is replaced
+func (r *Repo) loadCommitGraph(path string) graphfmt.Index {
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	r.graphMutex.Lock()
+	defer r.graphMutex.Unlock()
+	if r.graphs == nil {
+		r.graphs = make(map[string]*loadedCommitGraph)
+	}
+	if graph := r.graphs[path]; graph != nil && graph.modTime.Equal(fi.ModTime()) {
+		return graph.index
+	}
+	// the file is left open since nodes of the previous graph may still be in use; it is closed by the finalizer
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	index, err := graphfmt.OpenFileIndex(f)
+	if err != nil {
+		log.Warnf("invalid commit graph: %s: %s", path, err)
+		f.Close()
+		return nil
+	}
+	r.graphs[path] = &loadedCommitGraph{modTime: fi.ModTime(), index: index}
+	return index
+}
+
+func (r *Repo) gitCommitGraphPath() string {
+	if r.gitDir == "" {
+		return ""
+	}
+	return filepath.Join(r.gitDir, gitCommitGraphFile)
+}
+
+// commitNodeIndex returns the commit graph of git or gitan if available, or falls back to commit objects
+func (r *Repo) commitNodeIndex(repository *git.Repository) commitgraph.CommitNodeIndex {
+	for _, path := range []string{r.gitCommitGraphPath(), r.commitGraphPath} {
+		if index := r.loadCommitGraph(path); index != nil {
+			return commitgraph.NewGraphCommitNodeIndex(index, repository.Storer)
+		}
+	}
+	return commitgraph.NewObjectCommitNodeIndex(repository.Storer)
+}
+
+// isFiniteGeneration reports whether the generation number is known.
+// Zero is written by old versions of git, and math.MaxUint64 is returned for commits outside of commit graphs.
+func isFiniteGeneration(gen uint64) bool {
+	return gen != 0 && gen != math.MaxUint64
+}
+
+// isAncestorNode reports whether target is reachable from any of nodes, pruning by generation numbers
+func isAncestorNode(target commitgraph.CommitNode, nodes []commitgraph.CommitNode, seen map[plumbing.Hash]bool) (bool, error) {
+	gen := target.Generation()
+	stack := append([]commitgraph.CommitNode(nil), nodes...)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.ID() == target.ID() {
+			return true, nil
+		}
+		if seen[node.ID()] {
+			continue
+		}
+		seen[node.ID()] = true
+		// ancestors have smaller generations. Commits in a graph have finite generations and their ancestors are in it,
+		// so a node of a finite generation not greater than that of target (which may be infinite) cannot reach it.
+		if nodeGen := node.Generation(); isFiniteGeneration(nodeGen) && gen != 0 && nodeGen <= gen {
+			continue
+		}
+		err := node.ParentNodes().ForEach(func(parent commitgraph.CommitNode) error {
+			stack = append(stack, parent)
+			return nil
+		})
+		if err != nil {
+			return false, errors.Wrap(err, "obtaining parent commit failed")
+		}
+	}
+	return false, nil
+}
+
+// UpdateCommitGraph writes the commit graph of all refs to the path set by SetCommitGraphPath
+// unless the repository has its own commit-graph or every ref is already in the graph
+func (r *Repo) UpdateCommitGraph() error {
+	if r.commitGraphPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(r.gitCommitGraphPath()); err == nil {
+		return nil
+	}
+	repository, err := r.open()
+	if err != nil {
+		return err
+	}
+	tips, err := refTips(repository, nil)
+	if err != nil {
+		return err
+	}
+	old := r.loadCommitGraph(r.commitGraphPath)
+	if old != nil && containsAll(old, tips) {
+		return nil
+	}
+	mi := graphfmt.NewMemoryIndex()
+	generations := make(map[plumbing.Hash]int)
+	type frame struct {
+		hash plumbing.Hash
+		data *graphfmt.CommitData
+	}
+	for _, tip := range tips {
+		stack := []*frame{{hash: tip}}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if _, ok := generations[top.hash]; ok {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			if top.data == nil {
+				top.data, err = commitData(repository, old, top.hash)
+				if err != nil {
+					return err
+				}
+			}
+			pushed := false
+			gen := 0
+			for _, parent := range top.data.ParentHashes {
+				parentGen, ok := generations[parent]
+				if !ok {
+					stack = append(stack, &frame{hash: parent})
+					pushed = true
+				} else if parentGen > gen {
+					gen = parentGen
+				}
+			}
+			if pushed {
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			generations[top.hash] = gen + 1
+			mi.Add(top.hash, &graphfmt.CommitData{
+				TreeHash:     top.data.TreeHash,
+				ParentHashes: top.data.ParentHashes,
+				Generation:   gen + 1,
+				When:         top.data.When,
+			})
+		}
+	}
+	err = writeCommitGraph(r.commitGraphPath, mi)
+	if err != nil {
+		return errors.Wrapf(err, "writing commit graph failed: %s", r.commitGraphPath)
+	}
+	log.Infof("wrote commit graph of %s (%d commits)", r.path, len(generations))
+	return nil
+}
+
+// refTips returns commits pointed by refs accepted by filter (or all refs if nil); annotated tags are peeled
+func refTips(repository *git.Repository, filter func(plumbing.ReferenceName) bool) ([]plumbing.Hash, error) {
+	refIter, err := repository.References()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining references failed")
+	}
+	tips := make([]plumbing.Hash, 0)
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || (filter != nil && !filter(ref.Name())) {
+			return nil
+		}
+		h := ref.Hash()
+		if to, err := repository.TagObject(h); err == nil {
+			ci, err := to.Commit()
+			if err != nil {
+				return nil
+			}
+			h = ci.Hash
+		}
+		if _, err := repository.CommitObject(h); err != nil {
+			return nil
+		}
+		tips = append(tips, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tips, nil
+}
+
+func containsAll(index graphfmt.Index, hashes []plumbing.Hash) bool {
+	for _, h := range hashes {
+		if _, err := index.GetIndexByHash(h); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// commitData reads the commit from the previous graph if possible to avoid decoding the object
+func commitData(repository *git.Repository, old graphfmt.Index, h plumbing.Hash) (*graphfmt.CommitData, error) {
+	if old != nil {
+		if i, err := old.GetIndexByHash(h); err == nil {
+			if data, err := old.GetCommitDataByIndex(i); err == nil {
+				return data, nil
+			}
+		}
+	}
+	ci, err := repository.CommitObject(h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "obtaining commit failed: %s", h)
+	}
+	return &graphfmt.CommitData{
+		TreeHash:     ci.TreeHash,
+		ParentHashes: ci.ParentHashes,
+		When:         ci.Committer.When,
+	}, nil
+}
+
+func writeCommitGraph(path string, index graphfmt.Index) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = graphfmt.NewEncoder(f).Encode(index)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
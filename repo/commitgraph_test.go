@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestReachabilityWithCommitGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitan-graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	graphPath := filepath.Join(dir, "commit-graph")
+
+	// c1 <- c2 <- c3 (main)
+	//        ^
+	//        +--- c4 (secret)
+	tr := newTestRepo(t)
+	c1 := tr.commit("c1", map[string]testFile{"a.txt": regular("1")})
+	c2 := tr.commit("c2", map[string]testFile{"a.txt": regular("2")}, c1)
+	c3 := tr.commit("c3", map[string]testFile{"a.txt": regular("3")}, c2)
+	c4 := tr.commit("c4", map[string]testFile{"a.txt": regular("4")}, c2)
+	tr.setRef("refs/heads/main", c3)
+	tr.setRef("refs/heads/secret", c4)
+
+	check := func(t *testing.T, r *Repo, visible []plumbing.Hash, hidden []plumbing.Hash) {
+		r.SetAllowedRefs([]string{"refs/heads/main"})
+		for _, h := range visible {
+			if got, err := r.GetCommitHash(h.String()); err != nil || got != h.String() {
+				t.Errorf("GetCommitHash(%s) = %q, %v, want visible", h, got, err)
+			}
+		}
+		for _, h := range hidden {
+			if got, err := r.GetCommitHash(h.String()); errors.Cause(err) != errRevisionNotVisible {
+				t.Errorf("GetCommitHash(%s) = %q, %v, want errRevisionNotVisible", h, got, err)
+			}
+		}
+	}
+
+	t.Run("without graph", func(t *testing.T) {
+		check(t, tr.open(), []plumbing.Hash{c1, c2, c3}, []plumbing.Hash{c4})
+	})
+
+	graphed := tr.open()
+	graphed.SetCommitGraphPath(graphPath)
+	err = graphed.UpdateCommitGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graphed.loadCommitGraph(graphPath) == nil {
+		t.Fatal("commit graph is not written")
+	}
+	t.Run("with graph", func(t *testing.T) {
+		check(t, graphed, []plumbing.Hash{c1, c2, c3}, []plumbing.Hash{c4})
+	})
+
+	// commits after the graph is written have no generation numbers:
+	// c1 <- c2 <- c3 <- c5 <- c7 (main)
+	//        ^
+	//        +--- c4 <- c6 (secret)
+	c5 := tr.commit("c5", map[string]testFile{"a.txt": regular("5")}, c3)
+	c6 := tr.commit("c6", map[string]testFile{"a.txt": regular("6")}, c4)
+	c7 := tr.commit("c7", map[string]testFile{"a.txt": regular("7")}, c5)
+	tr.setRef("refs/heads/main", c7)
+	tr.setRef("refs/heads/secret", c6)
+	visible := []plumbing.Hash{c1, c2, c3, c5, c7}
+	hidden := []plumbing.Hash{c4, c6}
+
+	t.Run("with graph and newer commits", func(t *testing.T) {
+		r := tr.open()
+		r.SetCommitGraphPath(graphPath)
+		check(t, r, visible, hidden)
+	})
+	t.Run("without graph and newer commits", func(t *testing.T) {
+		check(t, tr.open(), visible, hidden)
+	})
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+)
+
+// FileDiff is a change of a file between two commits
+type FileDiff struct {
+	// Action is "add", "delete" or "modify"
+	Action    string `json:"action"`
+	FromPath  string `json:"from_path,omitempty"`
+	FromHash  string `json:"from_hash,omitempty"`
+	ToPath    string `json:"to_path,omitempty"`
+	ToHash    string `json:"to_hash,omitempty"`
+	IsBinary  bool   `json:"is_binary"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	// Patch is the unified diff of the file
+	Patch string `json:"patch,omitempty"`
+}
+
+func diffAction(action merkletrie.Action) string {
+	switch action {
+	case merkletrie.Insert:
+		return "add"
+	case merkletrie.Delete:
+		return "delete"
+	}
+	return "modify"
+}
+
+func newFileDiff(change *object.Change) (*FileDiff, error) {
+	action, err := change.Action()
+	if err != nil {
+		return nil, err
+	}
+	fd := &FileDiff{
+		Action: diffAction(action),
+	}
+	if action != merkletrie.Insert {
+		fd.FromPath = change.From.Name
+		fd.FromHash = change.From.TreeEntry.Hash.String()
+	}
+	if action != merkletrie.Delete {
+		fd.ToPath = change.To.Name
+		fd.ToHash = change.To.TreeEntry.Hash.String()
+	}
+	patch, err := change.Patch()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining patch failed")
+	}
+	for _, fp := range patch.FilePatches() {
+		fd.IsBinary = fd.IsBinary || fp.IsBinary()
+	}
+	for _, stat := range patch.Stats() {
+		fd.Additions += stat.Addition
+		fd.Deletions += stat.Deletion
+	}
+	fd.Patch = patch.String()
+	return fd, nil
+}
+
+// GetDiff returns changes of files from the commit from to the commit to.
+// If from is empty, to is compared with its first parent (or the empty tree for a root commit).
+// At most limit files are diffed unless limit is 0.
+func (r *Repo) GetDiff(from string, to string, limit int) ([]*FileDiff, error) {
+	toCommit, err := r.resolveCommit(to)
+	if err != nil {
+		return nil, err
+	}
+	var fromCommit *object.Commit
+	if from != "" {
+		fromCommit, err = r.resolveCommit(from)
+		if err != nil {
+			return nil, err
+		}
+	} else if toCommit.NumParents() > 0 {
+		fromCommit, err = toCommit.Parent(0)
+		if err != nil {
+			return nil, errors.Wrap(err, "obtaining parent failed")
+		}
+	}
+	cacheKey := fmt.Sprintf("diff::%s", toCommit.ID())
+	if fromCommit != nil {
+		cacheKey = fmt.Sprintf("diff:%s:%s", fromCommit.ID(), toCommit.ID())
+	}
+	results := make([]*FileDiff, 0)
+	if r.cache.Get(cacheKey, &results) {
+		if limit > 0 && len(results) > limit {
+			results = results[:limit]
+		}
+		return results, nil
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining tree failed")
+	}
+	var fromTree *object.Tree
+	if fromCommit != nil {
+		fromTree, err = fromCommit.Tree()
+		if err != nil {
+			return nil, errors.Wrap(err, "obtaining tree failed")
+		}
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining diff failed")
+	}
+	for _, change := range changes {
+		if limit > 0 && len(results) >= limit {
+			// partial results are not cached
+			return results, nil
+		}
+		fd, err := newFileDiff(change)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, fd)
+	}
+	r.cache.Put(cacheKey, results)
+	return results, nil
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+)
+
+// lastCommitMaxDepth limits the number of commits walked to find last commits of tree entries
+const lastCommitMaxDepth = 10000
+
+// TreeExpansion selects optional fields to be filled in tree entries
+type TreeExpansion struct {
+	Size bool
+	// Type fills the type (the same as the kind) and resolves the target of symlinks
+	Type       bool
+	LastCommit bool
+}
+
+// ExpandTreeEntries fills optional fields of entries listed in dir at rev
+func (r *Repo) ExpandTreeEntries(rev string, dir string, tes []*TreeEntry, exp *TreeExpansion) error {
+	if exp == nil || (!exp.Size && !exp.Type && !exp.LastCommit) {
+		return nil
+	}
+	repository, err := r.open()
+	if err != nil {
+		return err
+	}
+	ci, err := r.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	for _, te := range tes {
+		if exp.Type {
+			te.Type = te.Kind
+		}
+		if te.Kind == KindDir || te.Kind == KindSubmodule {
+			continue
+		}
+		if !exp.Size && !(exp.Type && te.Kind == KindSymlink) {
+			continue
+		}
+		blob, err := repository.BlobObject(plumbing.NewHash(te.Hash))
+		if err != nil {
+			return errors.Wrap(err, "obtaining blob object failed")
+		}
+		if exp.Size {
+			size := blob.Size
+			te.Size = &size
+		}
+		if exp.Type && te.Kind == KindSymlink {
+			reader, err := blob.Reader()
+			if err != nil {
+				return errors.Wrap(err, "opening blob failed")
+			}
+			bs, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				return errors.Wrap(err, "reading blob failed")
+			}
+			te.Target = string(bs)
+		}
+	}
+	if exp.LastCommit {
+		node, err := r.commitNodeIndex(repository).Get(ci.Hash)
+		if err != nil {
+			return errors.Wrap(err, "obtaining commit failed")
+		}
+		return r.fillLastCommits(node, dir, tes)
+	}
+	return nil
+}
+
+func entryHashAt(tree *object.Tree, path string) plumbing.Hash {
+	if tree == nil {
+		return plumbing.ZeroHash
+	}
+	if path == "" {
+		return tree.Hash
+	}
+	te, err := tree.FindEntry(path)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return te.Hash
+}
+
+// fillLastCommits walks the first-parent history and finds the commit which last changed each entry
+func (r *Repo) fillLastCommits(node commitgraph.CommitNode, dir string, tes []*TreeEntry) error {
+	pending := make(map[*TreeEntry]plumbing.Hash)
+	for _, te := range tes {
+		pending[te] = plumbing.NewHash(te.Hash)
+	}
+	commits := make(map[plumbing.Hash]*Commit)
+	for depth := 0; len(pending) > 0 && depth < lastCommitMaxDepth; depth++ {
+		var parentTree *object.Tree
+		var parent commitgraph.CommitNode
+		if node.NumParents() > 0 {
+			var err error
+			parent, err = node.ParentNode(0)
+			if err != nil {
+				return errors.Wrap(err, "obtaining parent commit failed")
+			}
+			parentTree, err = parent.Tree()
+			if err != nil {
+				return errors.Wrap(err, "obtaining tree from commit failed")
+			}
+		}
+		for te, h := range pending {
+			if entryHashAt(parentTree, gitPathJoin(dir, te.Name)) == h {
+				continue
+			}
+			h := node.ID()
+			commit := commits[h]
+			if commit == nil {
+				var err error
+				commit, err = r.getCommitWithHash(&h, false)
+				if err != nil {
+					return err
+				}
+				commits[h] = commit
+			}
+			te.LastCommit = commit
+			delete(pending, te)
+		}
+		if parent == nil {
+			break
+		}
+		node = parent
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandTreeEntriesLastCommit(t *testing.T) {
+	tr := newTestRepo(t)
+	c1 := tr.commit("c1", map[string]testFile{
+		"a.txt":      regular("1"),
+		"b.txt":      regular("b"),
+		"dir/x.txt":  regular("x"),
+		"dir/y.txt":  regular("y"),
+		"other/z.go": regular("z"),
+	})
+	c2 := tr.commit("c2", map[string]testFile{
+		"a.txt":      regular("2"),
+		"b.txt":      regular("b"),
+		"dir/x.txt":  regular("x2"),
+		"dir/y.txt":  regular("y"),
+		"other/z.go": regular("z"),
+	}, c1)
+	// a side branch merged into the first-parent history
+	side := tr.commit("side", map[string]testFile{
+		"a.txt":      regular("1"),
+		"b.txt":      regular("b"),
+		"dir/x.txt":  regular("x"),
+		"dir/y.txt":  regular("y"),
+		"other/z.go": regular("side"),
+	}, c1)
+	c3 := tr.commit("c3", map[string]testFile{
+		"a.txt":      regular("1"),
+		"b.txt":      regular("b"),
+		"dir/x.txt":  regular("x2"),
+		"dir/y.txt":  regular("y"),
+		"new.txt":    regular("new"),
+		"other/z.go": regular("side"),
+	}, c2, side)
+	tr.setRef("refs/heads/master", c3)
+	r := tr.open()
+
+	tests := []struct {
+		dir  string
+		want map[string]string
+	}{
+		{"", map[string]string{
+			// changed back to the contents of c1
+			"a.txt": c3.String(),
+			"b.txt": c1.String(),
+			"dir":   c2.String(),
+			// changes merged from other parents belong to the merge commit
+			"new.txt": c3.String(),
+			"other":   c3.String(),
+		}},
+		{"dir", map[string]string{"x.txt": c2.String(), "y.txt": c1.String()}},
+	}
+	for _, tt := range tests {
+		tes, err := r.GetTree(tt.dir, "master")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.ExpandTreeEntries("master", tt.dir, tes, &TreeExpansion{LastCommit: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, te := range tes {
+			if te.LastCommit == nil {
+				t.Errorf("%s/%s has no last commit", tt.dir, te.Name)
+				continue
+			}
+			got[te.Name] = te.LastCommit.ID
+			if te.Size != nil || te.Type != "" {
+				t.Errorf("%s/%s is expanded more than the last commit: %+v", tt.dir, te.Name, te)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("last commits of %q = %v, want %v", tt.dir, got, tt.want)
+		}
+	}
+
+	// the last commits of entries of older revisions are found from the revision
+	tes, err := r.GetTree("", c2.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.ExpandTreeEntries(c2.String(), "", tes, &TreeExpansion{LastCommit: true, Size: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, te := range tes {
+		want := c1.String()
+		if te.Name == "a.txt" || te.Name == "dir" {
+			want = c2.String()
+		}
+		if te.LastCommit == nil || te.LastCommit.ID != want {
+			t.Errorf("%s: last commit = %+v, want %s", te.Name, te.LastCommit, want)
+		}
+		if (te.Kind == KindFile) != (te.Size != nil) {
+			t.Errorf("%s: size = %v", te.Name, te.Size)
+		}
+	}
+}
+
+func TestExpandTreeEntriesWithoutExpansion(t *testing.T) {
+	// repos are not opened unless some fields are expanded
+	r := NewLazyRepo("/nonexistent/gitan", NewPool(1))
+	tes := []*TreeEntry{{Name: "a.txt"}}
+	for _, exp := range []*TreeExpansion{nil, {}} {
+		if err := r.ExpandTreeEntries("master", "", tes, exp); err != nil {
+			t.Errorf("ExpandTreeEntries(%+v) = %v", exp, err)
+		}
+	}
+	if err := r.ExpandTreeEntries("master", "", tes, &TreeExpansion{Size: true}); err == nil {
+		t.Error("ExpandTreeEntries() of a missing repo succeeded")
+	}
+}
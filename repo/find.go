@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// ErrStop can be returned by the callback of Walk to stop walking without an error
+var ErrStop = errors.New("stop walking")
+
+// FindOptions filters and limits entries found by Walk
+type FindOptions struct {
+	// MaxDepth limits the depth of directories to descend; 0 means unlimited
+	MaxDepth int
+	// Patterns are globs (see MatchGlob) matched against paths relative to the walked directory.
+	// Entries must match any of the patterns unless every pattern is an exclusion prefixed with "!",
+	// and must match none of the exclusions. Directories matching an exclusion ending with "/**" are not descended.
+	Patterns []string
+	// Kinds restricts kinds of entries; KindFile also matches executables. Empty allows every kind.
+	Kinds []Kind
+	// MinSize and MaxSize restrict sizes of blobs (0 means unbounded); other entries are excluded if either is set
+	MinSize int64
+	MaxSize int64
+	// Limit is the maximum number of entries; 0 means unlimited
+	Limit int
+}
+
+func (opts *FindOptions) isFiltered() bool {
+	return len(opts.Patterns) != 0 || len(opts.Kinds) != 0 || opts.MinSize != 0 || opts.MaxSize != 0 || opts.Limit != 0
+}
+
+func (opts *FindOptions) matchPatterns(name string) bool {
+	included := true
+	for _, pattern := range opts.Patterns {
+		if !strings.HasPrefix(pattern, "!") {
+			included = false
+			break
+		}
+	}
+	for _, pattern := range opts.Patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if MatchGlob(pattern[1:], name) {
+				return false
+			}
+		} else if !included && MatchGlob(pattern, name) {
+			included = true
+		}
+	}
+	return included
+}
+
+// isPruned reports whether every entry under the directory is excluded
+func (opts *FindOptions) isPruned(dir string) bool {
+	for _, pattern := range opts.Patterns {
+		if strings.HasPrefix(pattern, "!") && strings.HasSuffix(pattern, "/**") && MatchGlob(pattern[1:], dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *FindOptions) matchKind(kind Kind) bool {
+	if len(opts.Kinds) == 0 {
+		return true
+	}
+	for _, k := range opts.Kinds {
+		if k == kind || (k == KindFile && kind.IsFile()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFindOptions reports whether te passes the filters; sizes of blobs are filled if size filters are set
+func (r *Repo) matchFindOptions(opts *FindOptions, te *TreeEntry) (bool, error) {
+	if !opts.matchKind(te.Kind) || !opts.matchPatterns(te.Name) {
+		return false, nil
+	}
+	if opts.MinSize == 0 && opts.MaxSize == 0 {
+		return true, nil
+	}
+	if !te.Kind.IsFile() && te.Kind != KindSymlink {
+		return false, nil
+	}
+	size, err := r.blobSize(plumbing.NewHash(te.Hash))
+	if err != nil {
+		return false, err
+	}
+	te.Size = &size
+	return (opts.MinSize == 0 || size >= opts.MinSize) && (opts.MaxSize == 0 || size <= opts.MaxSize), nil
+}
+
+func (r *Repo) blobSize(h plumbing.Hash) (int64, error) {
+	repository, err := r.open()
+	if err != nil {
+		return 0, err
+	}
+	obj, err := repository.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return 0, errors.Wrap(err, "obtaining blob object failed")
+	}
+	return obj.Size(), nil
+}
+
+// Walk calls fn with each entry under path at rev whose Name is the path relative to path.
+// Directories are descended even if they do not match the options.
+func (r *Repo) Walk(path string, rev string, opts *FindOptions, fn func(*TreeEntry) error) error {
+	h, err := r.resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = &FindOptions{}
+	}
+	err = r.walkWithHash(h, path, opts, fn)
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+func (r *Repo) walkWithHash(h *plumbing.Hash, path string, opts *FindOptions, fn func(*TreeEntry) error) error {
+	count := 0
+	stack := []string{""}
+	for len(stack) > 0 {
+		idx := len(stack) - 1
+		if opts.MaxDepth > 0 && len(stack) > opts.MaxDepth {
+			stack = stack[:idx]
+			continue
+		}
+		p := stack[idx]
+		stack = stack[:idx]
+		treePath := gitPathJoin(path, p)
+		tes, err := r.getTreeWithHash(h, treePath)
+		if err != nil {
+			return err
+		}
+		for _, te := range tes {
+			childPath := gitPathJoin(p, te.Name)
+			if te.Kind == KindDir && !opts.isPruned(childPath) {
+				stack = append(stack, childPath)
+			}
+			result := *te
+			result.Name = childPath
+			ok, err := r.matchFindOptions(opts, &result)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if opts.Limit > 0 && count >= opts.Limit {
+				return ErrStop
+			}
+			count++
+			err = fn(&result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindWithOptions returns entries under path at rev filtered by opts
+func (r *Repo) FindWithOptions(path string, rev string, opts *FindOptions) ([]*TreeEntry, error) {
+	if opts == nil || !opts.isFiltered() {
+		maxDepth := 0
+		if opts != nil {
+			maxDepth = opts.MaxDepth
+		}
+		return r.Find(path, rev, maxDepth)
+	}
+	results := make([]*TreeEntry, 0)
+	err := r.Walk(path, rev, opts, func(te *TreeEntry) error {
+		results = append(results, te)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *Repo) Find(path string, rev string, maxDepth int) ([]*TreeEntry, error) {
+	h, err := r.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := fmt.Sprintf("find:%s:%d:%s", h, maxDepth, path)
+	results := make([]*TreeEntry, 0)
+	if r.cache.Get(cacheKey, &results) {
+		return results, nil
+	}
+	err = r.walkWithHash(h, path, &FindOptions{MaxDepth: maxDepth}, func(te *TreeEntry) error {
+		results = append(results, te)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.cache.Put(cacheKey, results)
+	return results, nil
+}
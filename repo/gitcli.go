@@ -0,0 +1,368 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// gitCLIMaxBufferedSize is the largest blob read through `cat-file --batch`; larger ones are streamed by another process
+const gitCLIMaxBufferedSize = 1 << 20
+
+// catFile is a long-running `git cat-file --batch` (or `--batch-check`) process started on the first request
+type catFile struct {
+	gitPath string
+	gitDir  string
+	mode    string
+	// onStart is called after the process is started
+	onStart func() error
+	mutex   sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+}
+
+type catFileHeader struct {
+	hash    plumbing.Hash
+	objType string
+	size    int64
+}
+
+func (c *catFile) start() error {
+	cmd := exec.Command(c.gitPath, "--git-dir="+c.gitDir, "cat-file", c.mode)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return errors.Wrap(err, "starting git failed")
+	}
+	c.cmd = cmd
+	c.stdin = stdin
+	c.stdout = bufio.NewReader(stdout)
+	if c.onStart != nil {
+		err = c.onStart()
+		if err != nil {
+			c.stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// stop kills the process so that the next request starts a new one with clean state
+func (c *catFile) stop() {
+	if c.cmd == nil {
+		return
+	}
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	c.cmd = nil
+}
+
+// Close stops the process; the next request starts it again
+func (c *catFile) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stop()
+	return nil
+}
+
+// request looks up the object and returns its header and contents (nil for --batch-check)
+func (c *catFile) request(name string) (*catFileHeader, []byte, error) {
+	if strings.ContainsAny(name, "\n") {
+		return nil, nil, errors.Errorf("invalid object name: %q", name)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cmd == nil {
+		err := c.start()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	header, contents, err := c.roundTrip(name)
+	if err != nil {
+		c.stop()
+		return nil, nil, errors.Wrap(err, "communicating with git cat-file failed")
+	}
+	return header, contents, nil
+}
+
+func (c *catFile) roundTrip(name string) (*catFileHeader, []byte, error) {
+	_, err := io.WriteString(c.stdin, name+"\n")
+	if err != nil {
+		return nil, nil, err
+	}
+	line, err := c.stdout.ReadString('\n')
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.HasSuffix(line, " missing\n") || strings.HasSuffix(line, " ambiguous\n") {
+		return nil, nil, nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, nil, errors.Errorf("unexpected output: %q", line)
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &catFileHeader{hash: plumbing.NewHash(fields[0]), objType: fields[1], size: size}
+	if c.mode != "--batch" {
+		return header, nil, nil
+	}
+	contents := make([]byte, size+1)
+	_, err = io.ReadFull(c.stdout, contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, contents[:size], nil
+}
+
+// gitCLIBackend reads objects by running the git command, which is faster than go-git on large packfiles
+type gitCLIBackend struct {
+	gitPath string
+	gitDir  string
+	batch   *catFile
+	check   *catFile
+}
+
+// NewGitCLIBackend creates a backend running gitPath (or "git" if empty) against the repository at gitDir
+func NewGitCLIBackend(gitPath string, gitDir string) Backend {
+	if gitPath == "" {
+		gitPath = "git"
+	}
+	return &gitCLIBackend{
+		gitPath: gitPath,
+		gitDir:  gitDir,
+		batch:   &catFile{gitPath: gitPath, gitDir: gitDir, mode: "--batch"},
+		check:   &catFile{gitPath: gitPath, gitDir: gitDir, mode: "--batch-check"},
+	}
+}
+
+func (b *gitCLIBackend) setOnStart(onStart func() error) {
+	b.batch.onStart = onStart
+	b.check.onStart = onStart
+}
+
+// Close stops the git processes of the backend
+func (b *gitCLIBackend) Close() error {
+	b.batch.Close()
+	b.check.Close()
+	return nil
+}
+
+// checkObject looks up the type and the size of the object without reading it
+func (b *gitCLIBackend) checkObject(name string, objType string) (*catFileHeader, error) {
+	header, _, err := b.check.request(name)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	if header.objType != objType {
+		return nil, errors.Errorf("obtaining %s failed: %s is %s", objType, name, header.objType)
+	}
+	return header, nil
+}
+
+// readObject reads the whole object after checking its type so that objects of other types are never buffered
+func (b *gitCLIBackend) readObject(name string, objType string) ([]byte, error) {
+	header, err := b.checkObject(name, objType)
+	if err != nil {
+		return nil, err
+	}
+	return b.readChecked(header)
+}
+
+// readChecked reads the object found by --batch-check
+func (b *gitCLIBackend) readChecked(header *catFileHeader) ([]byte, error) {
+	checked, contents, err := b.batch.request(header.hash.String())
+	if err != nil {
+		return nil, err
+	}
+	if checked == nil || checked.objType != header.objType {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	return contents, nil
+}
+
+func parseTree(bs []byte) ([]object.TreeEntry, error) {
+	entries := make([]object.TreeEntry, 0)
+	for len(bs) > 0 {
+		sp := bytes.IndexByte(bs, ' ')
+		nul := bytes.IndexByte(bs, 0)
+		if sp < 0 || nul < sp || len(bs) < nul+1+20 {
+			return nil, errors.New("invalid tree object")
+		}
+		mode, err := filemode.New(string(bs[:sp]))
+		if err != nil {
+			return nil, err
+		}
+		var h plumbing.Hash
+		copy(h[:], bs[nul+1:nul+21])
+		entries = append(entries, object.TreeEntry{Name: string(bs[sp+1 : nul]), Mode: mode, Hash: h})
+		bs = bs[nul+21:]
+	}
+	return entries, nil
+}
+
+func (b *gitCLIBackend) readTree(commit plumbing.Hash, path string) ([]object.TreeEntry, error) {
+	bs, err := b.readObject(commit.String()+":"+path, "tree")
+	if err == plumbing.ErrObjectNotFound {
+		err = object.ErrDirectoryNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining file or directory failed")
+	}
+	return parseTree(bs)
+}
+
+func (b *gitCLIBackend) Tree(commit plumbing.Hash, path string) ([]*TreeEntry, error) {
+	entries, err := b.readTree(commit, path)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*TreeEntry, 0, len(entries))
+	for i := range entries {
+		result, err := NewTreeEntry(&entries[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid tree entry")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (b *gitCLIBackend) File(commit plumbing.Hash, path string) (FileOpener, *FileStat, error) {
+	path = strings.Trim(path, "/")
+	dir, name := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		dir, name = path[:i], path[i+1:]
+	}
+	entries, err := b.readTree(commit, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, te := range entries {
+		if te.Name != name {
+			continue
+		}
+		if te.Mode == filemode.Dir {
+			return nil, nil, errors.New("obtaining directory")
+		}
+		if te.Mode == filemode.Submodule {
+			break
+		}
+		opener, head, size, err := b.openBlob(te.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		return opener, newFileStat(te.Hash, path, te.Mode, size, head), nil
+	}
+	return nil, nil, errors.Wrap(object.ErrDirectoryNotFound, "obtaining file or directory failed")
+}
+
+func (b *gitCLIBackend) Blob(hash plumbing.Hash) (FileOpener, error) {
+	opener, _, _, err := b.openBlob(hash)
+	return opener, err
+}
+
+// openBlob returns the opener, the first bytes for binary detection and the size of the blob
+func (b *gitCLIBackend) openBlob(hash plumbing.Hash) (FileOpener, []byte, int64, error) {
+	header, _, err := b.check.request(hash.String())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if header == nil || header.objType != "blob" {
+		return nil, nil, 0, errors.Wrap(plumbing.ErrObjectNotFound, "obtaining blob object failed")
+	}
+	if header.size <= gitCLIMaxBufferedSize {
+		contents, err := b.readChecked(header)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		opener := func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(contents)), nil }
+		return opener, contents, header.size, nil
+	}
+	opener := func() (io.ReadCloser, error) { return b.streamBlob(hash) }
+	reader, err := opener()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	head := make([]byte, BinaryCheckSize)
+	n, err := io.ReadFull(reader, head)
+	reader.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, nil, 0, errors.Wrap(err, "reading blob failed")
+	}
+	return opener, head[:n], header.size, nil
+}
+
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// streamBlob runs `git cat-file blob` to read a large blob without buffering it
+func (b *gitCLIBackend) streamBlob(hash plumbing.Hash) (io.ReadCloser, error) {
+	cmd := exec.Command(b.gitPath, "--git-dir="+b.gitDir, "cat-file", "blob", hash.String())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting git failed")
+	}
+	return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+func (b *gitCLIBackend) Log(from plumbing.Hash, limit int) ([]plumbing.Hash, error) {
+	args := []string{"--git-dir=" + b.gitDir, "rev-list"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", limit))
+	}
+	args = append(args, from.String())
+	var stderr bytes.Buffer
+	cmd := exec.Command(b.gitPath, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git rev-list failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	hashes := make([]plumbing.Hash, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			hashes = append(hashes, plumbing.NewHash(line))
+		}
+	}
+	return hashes, nil
+}
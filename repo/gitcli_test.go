@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+// newGitCLITestRepo creates a repository with the git command, skipping the test if git is not installed
+func newGitCLITestRepo(t *testing.T, files map[string]string) (string, plumbing.Hash) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitan-gitcli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) string {
+		cmd := exec.Command(gitPath, append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	for path, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(path))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(contents), 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "files")
+	return dir, plumbing.NewHash(git("rev-parse", "HEAD"))
+}
+
+func TestCatFile(t *testing.T) {
+	dir, commit := newGitCLITestRepo(t, map[string]string{"a.txt": "alpha\n"})
+	defer os.RemoveAll(dir)
+	c := &catFile{gitPath: "git", gitDir: filepath.Join(dir, ".git"), mode: "--batch"}
+	defer c.Close()
+
+	header, contents, err := c.request(commit.String() + ":a.txt")
+	if err != nil || header == nil || header.objType != "blob" || header.size != 6 || string(contents) != "alpha\n" {
+		t.Fatalf("request() = %+v, %q, %v", header, contents, err)
+	}
+	// the process is reused and stays in sync after reading contents
+	header, contents, err = c.request(commit.String())
+	if err != nil || header == nil || header.objType != "commit" || header.hash != commit || !strings.HasPrefix(string(contents), "tree ") {
+		t.Errorf("request() of the commit = %+v, %q, %v", header, contents, err)
+	}
+
+	for _, name := range []string{strings.Repeat("0", 40), commit.String() + ":missing.txt"} {
+		header, contents, err = c.request(name)
+		if err != nil || header != nil || contents != nil {
+			t.Errorf("request(%q) = %+v, %q, %v, want missing", name, header, contents, err)
+		}
+	}
+	_, _, err = c.request("HEAD\n" + commit.String())
+	if err == nil {
+		t.Error("request() of a name with a newline succeeded")
+	}
+
+	// a broken process is stopped and the next request starts another one
+	cmd := c.cmd
+	cmd.Process.Kill()
+	cmd.Wait()
+	_, _, err = c.request(commit.String())
+	if err == nil {
+		t.Error("request() to the killed process succeeded")
+	}
+	if c.cmd != nil {
+		t.Error("the killed process is not stopped")
+	}
+	header, contents, err = c.request(commit.String() + ":a.txt")
+	if err != nil || header == nil || string(contents) != "alpha\n" || c.cmd == cmd {
+		t.Errorf("request() after an error = %+v, %q, %v", header, contents, err)
+	}
+
+	check := &catFile{gitPath: "git", gitDir: filepath.Join(dir, ".git"), mode: "--batch-check"}
+	defer check.Close()
+	header, contents, err = check.request(commit.String() + ":a.txt")
+	if err != nil || header == nil || header.objType != "blob" || header.size != 6 || contents != nil {
+		t.Errorf("request() of --batch-check = %+v, %q, %v", header, contents, err)
+	}
+}
+
+func TestGitCLIBackend(t *testing.T) {
+	large := strings.Repeat("x", gitCLIMaxBufferedSize+1)
+	dir, commit := newGitCLITestRepo(t, map[string]string{
+		"a.txt":     "alpha\n",
+		"dir/b.txt": "bravo\n",
+		"large.txt": large,
+	})
+	defer os.RemoveAll(dir)
+	b := NewGitCLIBackend("", filepath.Join(dir, ".git")).(*gitCLIBackend)
+	defer b.Close()
+
+	tes, err := b.Tree(commit, "")
+	if err != nil || len(tes) != 3 || tes[0].Name != "a.txt" || tes[1].Name != "dir" || tes[1].Kind != KindDir {
+		t.Fatalf("Tree() = %v, %v", tes, err)
+	}
+	opener, stat, err := b.File(commit, "dir/b.txt")
+	if err != nil || stat.Size != 6 || stat.Kind != KindFile {
+		t.Fatalf("File() = %+v, %v", stat, err)
+	}
+	if bs, err := readAll(opener); err != nil || string(bs) != "bravo\n" {
+		t.Errorf("File() = %q, %v", bs, err)
+	}
+	if _, _, err := b.File(commit, "missing.txt"); err == nil {
+		t.Error("File() of a missing file succeeded")
+	}
+	if _, err := b.Blob(plumbing.ZeroHash); err == nil {
+		t.Error("Blob() of a missing blob succeeded")
+	}
+
+	_, stat, err = b.File(commit, "large.txt")
+	if err != nil || stat.Size != int64(len(large)) {
+		t.Fatalf("File() of the large file = %+v, %v", stat, err)
+	}
+
+	// objects of other types or too large blobs are never read through --batch
+	b.batch.Close()
+	if _, err := b.Tree(commit, "large.txt"); err == nil {
+		t.Error("Tree() of a file succeeded")
+	}
+	opener, err = b.Blob(plumbing.NewHash(stat.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.batch.cmd != nil {
+		t.Error("git cat-file --batch is started for a tree of a file or a large blob")
+	}
+	if bs, err := readAll(opener); err != nil || string(bs) != large {
+		t.Errorf("Blob() of the large file = %d bytes, %v, want %d bytes", len(bs), err, len(large))
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	h := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	entry := func(mode string, name string) string {
+		return mode + " " + name + "\x00" + string(h[:])
+	}
+	entries, err := parseTree([]byte(entry("100644", "a.txt") + entry("40000", "dir with space")))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("parseTree() = %v, %v", entries, err)
+	}
+	if entries[0].Name != "a.txt" || entries[0].Mode != filemode.Regular || entries[0].Hash != h {
+		t.Errorf("parseTree()[0] = %+v", entries[0])
+	}
+	if entries[1].Name != "dir with space" || entries[1].Mode != filemode.Dir {
+		t.Errorf("parseTree()[1] = %+v", entries[1])
+	}
+	if entries, err := parseTree(nil); err != nil || len(entries) != 0 {
+		t.Errorf("parseTree() of an empty tree = %v, %v", entries, err)
+	}
+
+	for _, bs := range []string{
+		"100644",
+		"100644 a.txt",
+		"100644a.txt\x00" + string(h[:]),
+		"100644 a.txt\x00" + string(h[:19]),
+		entry("100644", "a.txt") + "100644 b.txt\x00",
+		"\x00" + string(h[:]) + " a.txt",
+		entry("abc", "a.txt"),
+	} {
+		if entries, err := parseTree([]byte(bs)); err == nil {
+			t.Errorf("parseTree(%q) = %v, want an error", bs, entries)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// patterns without "/" match base names
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/gitan/main.go", true},
+		{"*.go", "main.go.orig", false},
+		{"main.?o", "src/main.go", true},
+		{"[a-c]*", "dir/beta", true},
+		{"[a-c]*", "dir/delta", false},
+		{"README*", "README.md", true},
+		// patterns with "/" match whole paths
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/sub/main.go", false},
+		{"src/*.go", "lib/src/main.go", false},
+		{"*/main.go", "cmd/main.go", true},
+		{"*/main.go", "main.go", false},
+		// "**" matches any number of directories
+		{"**/main.go", "main.go", true},
+		{"**/main.go", "cmd/gitan/main.go", true},
+		{"src/**", "src", true},
+		{"src/**", "src/a/b/c.txt", true},
+		{"src/**", "lib/a.txt", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "src/a/b/main.c", false},
+		{"**/test/**", "a/test/b/c", true},
+		{"**/test/**", "a/testing/b", false},
+		{"refs/tags/v*", "refs/tags/v1.0", true},
+		{"refs/tags/v*", "refs/heads/v1.0", false},
+		{"refs/heads/*", "refs/heads/feature/x", false},
+		{"refs/heads/**", "refs/heads/feature/x", true},
+		// "*" does not cross directories
+		{"local/*/proj", "local/alice/proj", true},
+		{"local/*/proj", "local/alice/x/proj", false},
+		// malformed patterns match nothing
+		{"[", "[", false},
+		{"src/[", "src/[", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindWithOptions(t *testing.T) {
+	tr := newTestRepo(t)
+	tr.setRef("refs/heads/master", tr.commit("files", map[string]testFile{
+		"README.md":             regular("readme"),
+		"main.go":               regular("package main\n"),
+		"cmd/gitan/main.go":     regular("package main\n\nfunc main() {}\n"),
+		"vendor/lib/lib.go":     regular("package lib\n"),
+		"vendor/lib/README.md":  regular("lib"),
+		"docs/guide/index.md":   regular(strings.Repeat("x", 100)),
+		"docs/link":             symlink("guide/index.md"),
+		"testdata/large.bin":    regular(strings.Repeat("\x00", 1000)),
+		"testdata/nested/a.txt": regular("a"),
+	}))
+	r := tr.open()
+	tests := []struct {
+		name string
+		path string
+		opts *FindOptions
+		want []string
+	}{
+		{
+			name: "include",
+			opts: &FindOptions{Patterns: []string{"*.go"}},
+			want: []string{"cmd/gitan/main.go", "main.go", "vendor/lib/lib.go"},
+		},
+		{
+			name: "include and exclude",
+			opts: &FindOptions{Patterns: []string{"*.go", "!vendor/**"}},
+			want: []string{"cmd/gitan/main.go", "main.go"},
+		},
+		{
+			name: "exclude only",
+			opts: &FindOptions{Patterns: []string{"!vendor/**", "!testdata/**", "!docs/**"}, Kinds: []Kind{KindFile}},
+			want: []string{"README.md", "cmd/gitan/main.go", "main.go"},
+		},
+		{
+			name: "any of includes",
+			opts: &FindOptions{Patterns: []string{"README.md", "**/guide/*"}},
+			want: []string{"README.md", "docs/guide/index.md", "vendor/lib/README.md"},
+		},
+		{
+			name: "relative to path",
+			path: "vendor",
+			opts: &FindOptions{Patterns: []string{"lib/*.go"}},
+			want: []string{"lib/lib.go"},
+		},
+		{
+			name: "kinds",
+			opts: &FindOptions{Kinds: []Kind{KindSymlink, KindDir}, Patterns: []string{"docs/**"}},
+			want: []string{"docs", "docs/guide", "docs/link"},
+		},
+		{
+			name: "sizes",
+			opts: &FindOptions{MinSize: 50, MaxSize: 500},
+			want: []string{"docs/guide/index.md"},
+		},
+		{
+			name: "pruned directories",
+			path: "testdata",
+			opts: &FindOptions{Patterns: []string{"!nested/**"}},
+			want: []string{"large.bin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tes, err := r.FindWithOptions(tt.path, "master", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(tes))
+			for _, te := range tes {
+				got = append(got, te.Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindWithOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	tes, err := r.FindWithOptions("", "master", &FindOptions{Patterns: []string{"*.md"}, Limit: 2})
+	if err != nil || len(tes) != 2 {
+		t.Errorf("FindWithOptions() with limit = %d entries, %v, want 2", len(tes), err)
+	}
+}
+
+func TestFindSkipsSubmodules(t *testing.T) {
+	tr := newTestRepo(t)
+	// gitlinks have the directory bit of the mode but must not be descended
+	tr.setRef("refs/heads/master", tr.commit("files", map[string]testFile{
+		"lib/a.txt": regular("a"),
+		"vendor/x":  {mode: filemode.Submodule, contents: "not a tree"},
+	}))
+	tes, err := tr.open().Find("", "master", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(tes))
+	for _, te := range tes {
+		got = append(got, te.Name+":"+string(te.Kind))
+	}
+	sort.Strings(got)
+	want := []string{"lib/a.txt:file", "lib:dir", "vendor/x:submodule", "vendor:dir"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// GrepContextLines is the number of lines reported around each match
+const GrepContextLines = 2
+
+type GrepMatch struct {
+	Path       string   `json:"path"`
+	LineNumber int      `json:"line_number"`
+	Line       string   `json:"line"`
+	Before     []string `json:"before"`
+	After      []string `json:"after"`
+}
+
+// CompileGrepPattern compiles the regular expression pattern of Grep
+func CompileGrepPattern(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pattern")
+	}
+	return re, nil
+}
+
+// Grep searches text files in the tree of rev for lines matching the regular expression pattern
+func (r *Repo) Grep(rev string, pattern string, pathGlobs []string, caseInsensitive bool, maxResults int) ([]*GrepMatch, error) {
+	re, err := CompileGrepPattern(pattern, caseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	ci, err := r.resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := ci.Tree()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining tree from commit failed")
+	}
+	results := make([]*GrepMatch, 0)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !matchAnyGlob(pathGlobs, f.Name) {
+			return nil
+		}
+		isBinary, err := f.IsBinary()
+		if err != nil || isBinary {
+			return nil
+		}
+		lines, err := f.Lines()
+		if err != nil {
+			return errors.Wrapf(err, "reading file failed: %s", f.Name)
+		}
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			if maxResults > 0 && len(results) >= maxResults {
+				return storer.ErrStop
+			}
+			begin := i - GrepContextLines
+			if begin < 0 {
+				begin = 0
+			}
+			end := i + 1 + GrepContextLines
+			if end > len(lines) {
+				end = len(lines)
+			}
+			results = append(results, &GrepMatch{
+				Path:       f.Name,
+				LineNumber: i + 1,
+				Line:       line,
+				Before:     lines[begin:i],
+				After:      lines[i+1 : end],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	tr := newTestRepo(t)
+	tr.setRef("refs/heads/master", tr.commit("files", map[string]testFile{
+		"a.txt":      regular("1\n2\nfoo 3\n4\n5\n6\nFOO 7\n"),
+		"b.go":       regular("package foo\n"),
+		"dir/c.go":   regular("// foo\n// foo\n"),
+		"binary.bin": regular("foo\x00"),
+	}))
+	r := tr.open()
+
+	matches, err := r.Grep("master", "foo", nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*GrepMatch{
+		{Path: "a.txt", LineNumber: 3, Line: "foo 3", Before: []string{"1", "2"}, After: []string{"4", "5"}},
+		{Path: "b.go", LineNumber: 1, Line: "package foo", Before: []string{}, After: []string{}},
+		{Path: "dir/c.go", LineNumber: 1, Line: "// foo", Before: []string{}, After: []string{"// foo"}},
+		{Path: "dir/c.go", LineNumber: 2, Line: "// foo", Before: []string{"// foo"}, After: []string{}},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("Grep() = %s, want %s", grepMatchesString(matches), grepMatchesString(want))
+	}
+
+	tests := []struct {
+		name            string
+		pattern         string
+		pathGlobs       []string
+		caseInsensitive bool
+		maxResults      int
+		want            []string
+	}{
+		{"case insensitive", "^foo", nil, true, 0, []string{"a.txt:3", "a.txt:7"}},
+		{"context at the end", "7$", nil, false, 0, []string{"a.txt:7"}},
+		{"path globs", "foo", []string{"*.go"}, false, 0, []string{"b.go:1", "dir/c.go:1", "dir/c.go:2"}},
+		{"path globs of directories", "foo", []string{"dir/**", "a.txt"}, false, 0, []string{"a.txt:3", "dir/c.go:1", "dir/c.go:2"}},
+		{"max results", "foo", nil, false, 2, []string{"a.txt:3", "b.go:1"}},
+		{"max results in a file", "foo", []string{"dir/*"}, false, 1, []string{"dir/c.go:1"}},
+		{"no match", "bar", nil, false, 0, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := r.Grep("master", tt.pattern, tt.pathGlobs, tt.caseInsensitive, tt.maxResults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(matches))
+			for _, m := range matches {
+				got = append(got, grepMatchString(m))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Grep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	matches, err = r.Grep("master", "7$", nil, false, 0)
+	if err != nil || len(matches) != 1 || !reflect.DeepEqual(matches[0].Before, []string{"5", "6"}) || len(matches[0].After) != 0 {
+		t.Errorf("Grep() = %s, %v, want 2 lines before and no lines after", grepMatchesString(matches), err)
+	}
+
+	if _, err := r.Grep("master", "(", nil, false, 0); err == nil {
+		t.Error("Grep() of an invalid pattern succeeded")
+	}
+	if _, err := r.Grep("missing", "foo", nil, false, 0); err == nil {
+		t.Error("Grep() of a missing revision succeeded")
+	}
+}
+
+func grepMatchString(m *GrepMatch) string {
+	return fmt.Sprintf("%s:%d", m.Path, m.LineNumber)
+}
+
+func grepMatchesString(matches []*GrepMatch) string {
+	ss := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ss = append(ss, fmt.Sprintf("%+v", *m))
+	}
+	return strings.Join(ss, ", ")
+}
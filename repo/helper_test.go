@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// testFile is a file in a commit built by testRepo
+type testFile struct {
+	mode     filemode.FileMode
+	contents string
+}
+
+func regular(contents string) testFile {
+	return testFile{mode: filemode.Regular, contents: contents}
+}
+
+func symlink(target string) testFile {
+	return testFile{mode: filemode.Symlink, contents: target}
+}
+
+// testRepo builds commits and refs on memory storage
+type testRepo struct {
+	t       *testing.T
+	storage *memory.Storage
+	now     time.Time
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	storage := memory.NewStorage()
+	err := storage.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, storage: storage, now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (tr *testRepo) store(o interface {
+	Encode(plumbing.EncodedObject) error
+}, objType plumbing.ObjectType) plumbing.Hash {
+	obj := tr.storage.NewEncodedObject()
+	obj.SetType(objType)
+	err := o.Encode(obj)
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	h, err := tr.storage.SetEncodedObject(obj)
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	return h
+}
+
+func (tr *testRepo) blob(contents string) plumbing.Hash {
+	obj := tr.storage.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	_, err = w.Write([]byte(contents))
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	h, err := tr.storage.SetEncodedObject(obj)
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	return h
+}
+
+// tree stores the tree of files whose paths are relative to the tree
+func (tr *testRepo) tree(files map[string]testFile) plumbing.Hash {
+	subtrees := make(map[string]map[string]testFile)
+	tree := &object.Tree{}
+	for path, f := range files {
+		if i := strings.Index(path, "/"); i >= 0 {
+			dir := path[:i]
+			if subtrees[dir] == nil {
+				subtrees[dir] = make(map[string]testFile)
+			}
+			subtrees[dir][path[i+1:]] = f
+			continue
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: path, Mode: f.mode, Hash: tr.blob(f.contents)})
+	}
+	for dir, sub := range subtrees {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: tr.tree(sub)})
+	}
+	// git sorts directories as if their names end with "/"
+	sortKey := func(te object.TreeEntry) string {
+		if te.Mode == filemode.Dir {
+			return te.Name + "/"
+		}
+		return te.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return sortKey(tree.Entries[i]) < sortKey(tree.Entries[j]) })
+	return tr.store(tree, plumbing.TreeObject)
+}
+
+// commit stores a commit of files; each commit is one minute later than the previous one
+func (tr *testRepo) commit(message string, files map[string]testFile, parents ...plumbing.Hash) plumbing.Hash {
+	tr.now = tr.now.Add(time.Minute)
+	sign := object.Signature{Name: "Test", Email: "test@example.com", When: tr.now}
+	return tr.store(&object.Commit{
+		Author:       sign,
+		Committer:    sign,
+		Message:      message,
+		TreeHash:     tr.tree(files),
+		ParentHashes: parents,
+	}, plumbing.CommitObject)
+}
+
+func (tr *testRepo) setRef(name string, h plumbing.Hash) {
+	err := tr.storage.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), h))
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+}
+
+func (tr *testRepo) open() *Repo {
+	r, err := NewRepoWithStorer(tr.storage)
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	return r
+}
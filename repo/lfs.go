@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// lfsPointerMaxSize is the maximum size of Git LFS pointer files
+const lfsPointerMaxSize = 1024
+
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+var lfsOIDPattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// LFSPointer is the contents of a Git LFS pointer file
+type LFSPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// ParseLFSPointer returns nil unless bs is a Git LFS pointer file
+func ParseLFSPointer(bs []byte) *LFSPointer {
+	if len(bs) > lfsPointerMaxSize || !bytes.HasPrefix(bs, []byte(lfsPointerVersion+"\n")) {
+		return nil
+	}
+	var pointer LFSPointer
+	hasSize := false
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		switch parts[0] {
+		case "oid":
+			oid := strings.TrimPrefix(parts[1], "sha256:")
+			if !lfsOIDPattern.MatchString(oid) {
+				return nil
+			}
+			pointer.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil
+			}
+			pointer.Size = size
+			hasSize = true
+		}
+	}
+	if pointer.OID == "" || !hasSize {
+		return nil
+	}
+	return &pointer
+}
+
+// IsValidLFSOID reports whether oid is a SHA-256 hex string
+func IsValidLFSOID(oid string) bool {
+	return lfsOIDPattern.MatchString(oid)
+}
+
+func (r *Repo) lfsObjectPath(oid string) (string, error) {
+	if r.gitDir == "" {
+		return "", errors.New("no local LFS store")
+	}
+	if !IsValidLFSOID(oid) {
+		return "", errors.Errorf("invalid LFS oid: %s", oid)
+	}
+	return filepath.Join(r.gitDir, "lfs", "objects", oid[0:2], oid[2:4], oid), nil
+}
+
+// StatLFSObject returns the size of the object in the local LFS store
+func (r *Repo) StatLFSObject(oid string) (int64, error) {
+	if len(r.allowedRefs) != 0 {
+		// reachability of LFS objects is too expensive to check as well as blobs
+		return 0, errors.New("obtaining LFS object by oid is not allowed when refs are restricted")
+	}
+	return r.statLFSObject(oid)
+}
+
+func (r *Repo) statLFSObject(oid string) (int64, error) {
+	path, err := r.lfsObjectPath(oid)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "obtaining LFS object failed: %s", oid)
+	}
+	return fi.Size(), nil
+}
+
+// OpenLFSObject opens the object in the local LFS store
+func (r *Repo) OpenLFSObject(oid string) (io.ReadCloser, error) {
+	if len(r.allowedRefs) != 0 {
+		return nil, errors.New("obtaining LFS object by oid is not allowed when refs are restricted")
+	}
+	return r.openLFSObject(oid)
+}
+
+func (r *Repo) openLFSObject(oid string) (io.ReadCloser, error) {
+	path, err := r.lfsObjectPath(oid)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening LFS object failed: %s", oid)
+	}
+	return f, nil
+}
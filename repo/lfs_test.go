@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name     string
+		contents string
+		want     *LFSPointer
+	}{
+		{
+			name:     "pointer",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+			want:     &LFSPointer{OID: oid, Size: 12345},
+		},
+		{
+			name:     "extra keys",
+			contents: "version https://git-lfs.github.com/spec/v1\next-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 0\n",
+			want:     &LFSPointer{OID: oid, Size: 0},
+		},
+		{
+			name:     "no trailing newline",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 1",
+			want:     &LFSPointer{OID: oid, Size: 1},
+		},
+		{
+			name:     "text file",
+			contents: "hello\n",
+		},
+		{
+			name:     "other version",
+			contents: "version https://hawser.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\n",
+		},
+		{
+			name:     "no oid",
+			contents: "version https://git-lfs.github.com/spec/v1\nsize 1\n",
+		},
+		{
+			name:     "no size",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\n",
+		},
+		{
+			name:     "short oid",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:0123\nsize 1\n",
+		},
+		{
+			name:     "upper-case oid",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + strings.ToUpper(oid) + "\nsize 1\n",
+		},
+		{
+			name:     "negative size",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize -1\n",
+		},
+		{
+			name:     "malformed line",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\ngarbage\n",
+		},
+		{
+			name:     "too large",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\nx " + strings.Repeat("x", lfsPointerMaxSize) + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseLFSPointer([]byte(tt.contents))
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("ParseLFSPointer() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.want {
+				t.Errorf("ParseLFSPointer() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidLFSOID(t *testing.T) {
+	tests := []struct {
+		oid  string
+		want bool
+	}{
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 65), false},
+		{strings.Repeat("g", 64), false},
+		{"../" + strings.Repeat("a", 61), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsValidLFSOID(tt.oid); got != tt.want {
+			t.Errorf("IsValidLFSOID(%q) = %v, want %v", tt.oid, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package repo
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// defaultDescription is written by git init and means no description
+const defaultDescription = "Unnamed repository; edit this file 'description' to name the repository."
+
+type Remote struct {
+	Name string   `json:"name"`
+	URLs []string `json:"urls"`
+}
+
+type Metadata struct {
+	Head          string    `json:"head"`
+	DefaultBranch string    `json:"default_branch"`
+	HeadCommitID  string    `json:"head_commit_id"`
+	Description   string    `json:"description"`
+	Remotes       []*Remote `json:"remotes"`
+	// LastUpdated is the latest committer time of all branches
+	LastUpdated time.Time `json:"last_updated"`
+	// ObjectCount and Size are left zero for repos with allowed refs since they include objects of every ref
+	ObjectCount int64 `json:"object_count"`
+	RefCount    int   `json:"ref_count"`
+	// Size is the approximate size of the object database on disk in bytes
+	Size      int64 `json:"size"`
+	IsBare    bool  `json:"is_bare"`
+	IsShallow bool  `json:"is_shallow"`
+}
+
+// gitDirFingerprint summarizes modification times of the files which metadata is derived from
+type gitDirFingerprint struct {
+	modTime int64
+	files   int
+}
+
+type cachedMetadata struct {
+	fingerprint gitDirFingerprint
+	metadata    *Metadata
+}
+
+// fingerprintGitDir stats HEAD, config, refs and directories of objects.
+// Adding or removing loose objects and packs updates the modification time of their directory,
+// so objects themselves are not walked.
+func fingerprintGitDir(gitDir string) gitDirFingerprint {
+	var fp gitDirFingerprint
+	add := func(fi os.FileInfo) {
+		fp.files++
+		if t := fi.ModTime().UnixNano(); t > fp.modTime {
+			fp.modTime = t
+		}
+	}
+	for _, name := range []string{"HEAD", "config", "description", "packed-refs", "shallow", "objects"} {
+		if fi, err := os.Stat(filepath.Join(gitDir, name)); err == nil {
+			add(fi)
+		}
+	}
+	if fis, err := ioutil.ReadDir(filepath.Join(gitDir, "objects")); err == nil {
+		for _, fi := range fis {
+			add(fi)
+		}
+	}
+	filepath.Walk(filepath.Join(gitDir, "refs"), func(path string, fi os.FileInfo, err error) error {
+		if err == nil {
+			add(fi)
+		}
+		return nil
+	})
+	return fp
+}
+
+// GetMetadata returns the summary of the repository.
+// The result is cached until files of the git directory change, so the repo is not opened nor are objects counted again.
+func (r *Repo) GetMetadata() (*Metadata, error) {
+	if r.gitDir == "" {
+		return r.getMetadata()
+	}
+	fp := fingerprintGitDir(r.gitDir)
+	r.metadataMutex.Lock()
+	cached := r.metadata
+	r.metadataMutex.Unlock()
+	if cached == nil || cached.fingerprint != fp {
+		meta, err := r.getMetadata()
+		if err != nil {
+			return nil, err
+		}
+		cached = &cachedMetadata{fingerprint: fp, metadata: meta}
+		r.metadataMutex.Lock()
+		r.metadata = cached
+		r.metadataMutex.Unlock()
+	}
+	// callers may override fields of the copy
+	meta := *cached.metadata
+	return &meta, nil
+}
+
+func (r *Repo) getMetadata() (*Metadata, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Remotes: make([]*Remote, 0),
+	}
+	head, err := repository.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining HEAD failed")
+	}
+	if h, err := r.resolveRevision(string(plumbing.HEAD)); err == nil {
+		meta.HeadCommitID = h.String()
+	}
+	// HEAD is reported only if it is visible
+	if head.Type() == plumbing.SymbolicReference {
+		if r.isRefAllowed(head.Target()) {
+			meta.Head = head.Target().String()
+			if head.Target().IsBranch() {
+				meta.DefaultBranch = head.Target().Short()
+			}
+		}
+	} else if meta.HeadCommitID != "" {
+		meta.Head = head.Hash().String()
+	}
+	cfg, err := repository.Config()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining config failed")
+	}
+	meta.IsBare = cfg.Core.IsBare
+	remotes, err := repository.Remotes()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining remotes failed")
+	}
+	for _, remote := range remotes {
+		meta.Remotes = append(meta.Remotes, &Remote{
+			Name: remote.Config().Name,
+			URLs: remote.Config().URLs,
+		})
+	}
+	shallow, err := repository.Storer.Shallow()
+	if err == nil {
+		meta.IsShallow = len(shallow) > 0
+	}
+	refIter, err := repository.References()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining references failed")
+	}
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !r.isRefAllowed(ref.Name()) {
+			return nil
+		}
+		meta.RefCount++
+		if !ref.Name().IsBranch() {
+			return nil
+		}
+		ci, err := repository.CommitObject(ref.Hash())
+		if err != nil {
+			return nil
+		}
+		if ci.Committer.When.After(meta.LastUpdated) {
+			meta.LastUpdated = ci.Committer.When
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.gitDir != "" {
+		if bs, err := ioutil.ReadFile(filepath.Join(r.gitDir, "description")); err == nil {
+			description := strings.TrimSpace(string(bs))
+			if description != defaultDescription {
+				meta.Description = description
+			}
+		}
+		if len(r.allowedRefs) == 0 {
+			meta.ObjectCount, meta.Size = countObjects(filepath.Join(r.gitDir, "objects"))
+		}
+	}
+	return meta, nil
+}
+
+// countObjects counts loose objects and objects in pack indexes, and sums up file sizes
+func countObjects(objectsDir string) (int64, int64) {
+	var count, size int64
+	filepath.Walk(objectsDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return nil
+		}
+		size += fi.Size()
+		rel, err := filepath.Rel(objectsDir, path)
+		if err != nil {
+			return nil
+		}
+		dir, name := filepath.Split(rel)
+		if len(dir) == 3 && len(name) == 38 {
+			count++
+		} else if strings.HasPrefix(rel, "pack"+string(filepath.Separator)) && strings.HasSuffix(name, ".idx") {
+			count += countPackIndex(path)
+		}
+		return nil
+	})
+	return count, size
+}
+
+// countPackIndex reads the number of objects from the fanout table of a version 2 pack index
+func countPackIndex(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	header := make([]byte, 8+256*4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0
+	}
+	if string(header[:4]) != "\xfftOc" || binary.BigEndian.Uint32(header[4:8]) != 2 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(header[8+255*4:]))
+}
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// newDiskTestRepo commits a file to master of a repository on disk
+func newDiskTestRepo(t *testing.T) (string, plumbing.Hash) {
+	dir, err := ioutil.TempDir("", "gitan-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	}
+	if err == nil {
+		_, err = worktree.Add("a.txt")
+	}
+	var h plumbing.Hash
+	if err == nil {
+		h, err = worktree.Commit("first", &git.CommitOptions{
+			Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		})
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, h
+}
+
+// touch writes the file and moves its modification time forward so that the change is visible to fingerprints
+func touch(t *testing.T, path string, contents string, modTime time.Time) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(contents), 0644)
+	}
+	if err == nil {
+		err = os.Chtimes(path, modTime, modTime)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetadataCache(t *testing.T) {
+	dir, h := newDiskTestRepo(t)
+	defer os.RemoveAll(dir)
+	gitDir := filepath.Join(dir, ".git")
+	r := NewLazyRepo(dir, NewPool(1))
+
+	meta, err := r.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Head != "refs/heads/master" || meta.HeadCommitID != h.String() || meta.RefCount != 1 || meta.Description != "" {
+		t.Errorf("GetMetadata() = %+v", meta)
+	}
+	// a blob, a tree and a commit
+	if meta.ObjectCount != 3 || meta.Size <= 0 || meta.IsBare {
+		t.Errorf("GetMetadata() = %+v, want 3 objects", meta)
+	}
+
+	// the cached metadata is returned while files of the git directory are unchanged
+	cached := r.metadata
+	cached.metadata.Description = "cached"
+	meta.Description = "modified by the caller"
+	meta, err = r.GetMetadata()
+	if err != nil || meta.Description != "cached" || r.metadata != cached {
+		t.Errorf("GetMetadata() = %+v, %v, want the cached one", meta, err)
+	}
+
+	modTime := time.Now().Add(time.Hour)
+	touch(t, filepath.Join(gitDir, "description"), "the description\n", modTime)
+	meta, err = r.GetMetadata()
+	if err != nil || meta.Description != "the description" || meta.RefCount != 1 {
+		t.Errorf("GetMetadata() after updating the description = %+v, %v", meta, err)
+	}
+
+	// new refs are found even if their modification times are older
+	touch(t, filepath.Join(gitDir, "refs", "tags", "v1"), h.String()+"\n", time.Unix(0, 0))
+	meta, err = r.GetMetadata()
+	if err != nil || meta.RefCount != 2 {
+		t.Errorf("GetMetadata() after adding a tag = %+v, %v", meta, err)
+	}
+
+	// directories of loose objects are created or updated by new objects
+	touch(t, filepath.Join(gitDir, "objects", "ff", "ffffffffffffffffffffffffffffffffffffff"), "", modTime.Add(time.Hour))
+	meta, err = r.GetMetadata()
+	if err != nil || meta.ObjectCount != 4 {
+		t.Errorf("GetMetadata() after adding an object = %+v, %v", meta, err)
+	}
+}
+
+func TestMetadataOfRestrictedRepo(t *testing.T) {
+	dir, _ := newDiskTestRepo(t)
+	defer os.RemoveAll(dir)
+	r := NewLazyRepo(dir, NewPool(1))
+	meta, err := r.GetMetadata()
+	if err != nil || meta.ObjectCount == 0 || meta.Size == 0 {
+		t.Fatalf("GetMetadata() = %+v, %v", meta, err)
+	}
+	// objects of invisible refs must not be disclosed by counts, even if the metadata is cached
+	r.SetAllowedRefs([]string{"refs/tags/*"})
+	meta, err = r.GetMetadata()
+	if err != nil || meta.ObjectCount != 0 || meta.Size != 0 || meta.RefCount != 0 || meta.Head != "" {
+		t.Errorf("GetMetadata() of restricted repo = %+v, %v", meta, err)
+	}
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+// Kind is the decoded type of a tree entry
+type Kind string
+
+const (
+	KindFile       Kind = "file"
+	KindExecutable Kind = "executable"
+	KindSymlink    Kind = "symlink"
+	KindDir        Kind = "dir"
+	KindSubmodule  Kind = "submodule"
+	KindUnknown    Kind = "unknown"
+)
+
+// NewKind decodes the Git file mode
+func NewKind(mode filemode.FileMode) Kind {
+	switch mode {
+	case filemode.Regular, filemode.Deprecated:
+		return KindFile
+	case filemode.Executable:
+		return KindExecutable
+	case filemode.Symlink:
+		return KindSymlink
+	case filemode.Dir:
+		return KindDir
+	case filemode.Submodule:
+		return KindSubmodule
+	}
+	return KindUnknown
+}
+
+// IsFile reports whether the entry is a regular (or executable) file
+func (k Kind) IsFile() bool {
+	return k == KindFile || k == KindExecutable
+}
+
+// Mode is the decoded Git file mode shared by FileStat and TreeEntry
+type Mode struct {
+	Mode      uint32 `json:"mode"`
+	ModeOctal string `json:"mode_octal"`
+	Kind      Kind   `json:"kind"`
+}
+
+// NewMode converts the Git file mode into its numeric, octal ("100644") and kind representations
+func NewMode(mode filemode.FileMode) Mode {
+	return Mode{
+		Mode:      uint32(mode),
+		ModeOctal: fmt.Sprintf("%06o", uint32(mode)),
+		Kind:      NewKind(mode),
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+)
+
+func TestNewKind(t *testing.T) {
+	tests := []struct {
+		mode filemode.FileMode
+		want Kind
+	}{
+		{filemode.Regular, KindFile},
+		{filemode.Deprecated, KindFile},
+		{filemode.Executable, KindExecutable},
+		{filemode.Symlink, KindSymlink},
+		{filemode.Dir, KindDir},
+		{filemode.Submodule, KindSubmodule},
+		{filemode.Empty, KindUnknown},
+		{filemode.FileMode(0100600), KindUnknown},
+	}
+	for _, tt := range tests {
+		if got := NewKind(tt.mode); got != tt.want {
+			t.Errorf("NewKind(%o) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+	if !KindFile.IsFile() || !KindExecutable.IsFile() || KindSymlink.IsFile() || KindDir.IsFile() || KindSubmodule.IsFile() {
+		t.Error("IsFile() is true only for regular and executable files")
+	}
+}
+
+func TestNewMode(t *testing.T) {
+	tests := []struct {
+		mode filemode.FileMode
+		want Mode
+	}{
+		{filemode.Regular, Mode{Mode: 0100644, ModeOctal: "100644", Kind: KindFile}},
+		{filemode.Executable, Mode{Mode: 0100755, ModeOctal: "100755", Kind: KindExecutable}},
+		{filemode.Symlink, Mode{Mode: 0120000, ModeOctal: "120000", Kind: KindSymlink}},
+		{filemode.Dir, Mode{Mode: 0040000, ModeOctal: "040000", Kind: KindDir}},
+		{filemode.Submodule, Mode{Mode: 0160000, ModeOctal: "160000", Kind: KindSubmodule}},
+	}
+	for _, tt := range tests {
+		if got := NewMode(tt.mode); got != tt.want {
+			t.Errorf("NewMode(%o) = %+v, want %+v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTreeEntriesType(t *testing.T) {
+	tr := newTestRepo(t)
+	tr.setRef("refs/heads/master", tr.commit("files", map[string]testFile{
+		"dir/a.txt": regular("a"),
+		"file.txt":  regular("contents"),
+		"link":      symlink("file.txt"),
+		"run.sh":    {mode: filemode.Executable, contents: "#!/bin/sh\n"},
+	}))
+	r := tr.open()
+	tes, err := r.GetTree("", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.ExpandTreeEntries("master", "", tes, &TreeExpansion{Type: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		ty     Kind
+		target string
+	}{
+		"dir":      {KindDir, ""},
+		"file.txt": {KindFile, ""},
+		"link":     {KindSymlink, "file.txt"},
+		"run.sh":   {KindExecutable, ""},
+	}
+	if len(tes) != len(want) {
+		t.Fatalf("GetTree() = %d entries, want %d", len(tes), len(want))
+	}
+	for _, te := range tes {
+		w := want[te.Name]
+		if te.Type != w.ty || te.Target != w.target || te.Size != nil {
+			t.Errorf("%s: type = %q, target = %q, size = %v, want %q and %q", te.Name, te.Type, te.Target, te.Size, w.ty, w.target)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+const (
+	// DefaultPoolSize is the number of repositories kept open when the size is not configured
+	DefaultPoolSize = 256
+	// PoolObjectCacheSize bounds the cache of decoded objects of each opened repository,
+	// which is 96 MiB by default in go-git; a full pool holds at most DefaultPoolSize * 4 MiB = 1 GiB
+	PoolObjectCacheSize = 4 * cache.MiByte
+)
+
+type poolEntry struct {
+	path       string
+	repository *git.Repository
+	// closers are closed on eviction (e.g. git processes of the backend)
+	closers []io.Closer
+}
+
+// Pool keeps a bounded number of opened repositories, evicting the least recently used one.
+// Each opened repository keeps decoded objects in a cache of PoolObjectCacheSize, which is released
+// when the repository is evicted and no longer used. Evicted repositories hold no file descriptors
+// (go-git reopens packfiles on demand), so callers still using an evicted handle are not affected.
+// Resources attached to evicted repositories are closed.
+type Pool struct {
+	size    int
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewPool creates a pool of at most size opened repositories
+func NewPool(size int) *Pool {
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+	return &Pool{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (p *Pool) get(path string) *git.Repository {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	elem := p.entries[path]
+	if elem == nil {
+		return nil
+	}
+	p.lru.MoveToFront(elem)
+	return elem.Value.(*poolEntry).repository
+}
+
+func (p *Pool) put(path string, repository *git.Repository) *git.Repository {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if elem := p.entries[path]; elem != nil {
+		// another request opened it concurrently
+		p.lru.MoveToFront(elem)
+		return elem.Value.(*poolEntry).repository
+	}
+	p.entries[path] = p.lru.PushFront(&poolEntry{path: path, repository: repository})
+	for p.lru.Len() > p.size {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		entry := oldest.Value.(*poolEntry)
+		delete(p.entries, entry.path)
+		for _, c := range entry.closers {
+			// closed in background since closers may wait for requests in progress, which may be opening another repository
+			go c.Close()
+		}
+	}
+	return repository
+}
+
+func (p *Pool) attach(path string, c io.Closer) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	elem := p.entries[path]
+	if elem == nil {
+		return false
+	}
+	p.lru.MoveToFront(elem)
+	entry := elem.Value.(*poolEntry)
+	for _, closer := range entry.closers {
+		if closer == c {
+			return true
+		}
+	}
+	entry.closers = append(entry.closers, c)
+	return true
+}
+
+// Attach opens the repository at path if it is not in the pool, and closes c when the repository is evicted
+func (p *Pool) Attach(path string, c io.Closer) error {
+	for !p.attach(path, c) {
+		_, err := p.Open(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open returns the repository at path, opening it if it is not in the pool
+func (p *Pool) Open(path string) (*git.Repository, error) {
+	if repository := p.get(path); repository != nil {
+		return repository, nil
+	}
+	repository, err := plainOpen(path, PoolObjectCacheSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening repo failed: %s", path)
+	}
+	return p.put(path, repository), nil
+}
+
+// plainOpen opens the repository at path like git.PlainOpen but with an object cache of cacheSize
+func plainOpen(path string, cacheSize cache.FileSize) (*git.Repository, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dot, worktree, err := dotGitFilesystems(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dot.Stat(""); err != nil {
+		if os.IsNotExist(err) {
+			return nil, git.ErrRepositoryNotExists
+		}
+		return nil, err
+	}
+	s := filesystem.NewStorageWithOptions(dot, cache.NewObjectLRU(cacheSize), filesystem.Options{})
+	return git.Open(s, worktree)
+}
+
+// dotGitFilesystems returns the .git directory (or the bare repository) and the worktree (nil if bare) at path
+func dotGitFilesystems(path string) (billy.Filesystem, billy.Filesystem, error) {
+	fs := osfs.New(path)
+	fi, err := fs.Stat(git.GitDirName)
+	if os.IsNotExist(err) {
+		return fs, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		dot, err := fs.Chroot(git.GitDirName)
+		return dot, fs, err
+	}
+	// .git files of linked worktrees and submodules point to the .git directory
+	bs, err := ioutil.ReadFile(filepath.Join(path, git.GitDirName))
+	if err != nil {
+		return nil, nil, err
+	}
+	const prefix = "gitdir: "
+	line := strings.SplitN(string(bs), "\n", 2)[0]
+	if !strings.HasPrefix(line, prefix) {
+		return nil, nil, errors.Errorf(".git file has no %s prefix", prefix)
+	}
+	gitDir := strings.TrimSpace(line[len(prefix):])
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(path, gitDir)
+	}
+	return osfs.New(gitDir), fs, nil
+}
+
+// Len returns the number of opened repositories
+func (p *Pool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.lru.Len()
+}
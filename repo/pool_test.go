@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// testCloser reports closes to a channel
+type testCloser struct {
+	name   string
+	closed chan string
+}
+
+func (c *testCloser) Close() error {
+	c.closed <- c.name
+	return nil
+}
+
+func newPoolTestDir(t *testing.T, names ...string) string {
+	dir, err := ioutil.TempDir("", "gitan-pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		_, err := git.PlainInit(filepath.Join(dir, name), false)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := newPoolTestDir(t, "a", "b", "c")
+	defer os.RemoveAll(dir)
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	p := NewPool(2)
+	ra, err := p.Open(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Open(b); err != nil {
+		t.Fatal(err)
+	}
+	// a is used more recently than b
+	if r, err := p.Open(a); err != nil || r != ra {
+		t.Errorf("Open() of the opened repo = %p, %v, want %p", r, err, ra)
+	}
+	if _, err := p.Open(c); err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 2 || p.get(a) != ra || p.get(b) != nil || p.get(c) == nil {
+		t.Errorf("pool has %d repos, a: %t, b: %t, c: %t, want a and c", p.Len(), p.get(a) != nil, p.get(b) != nil, p.get(c) != nil)
+	}
+	// evicted repos are opened again
+	if r, err := p.Open(b); err != nil || r == nil || p.get(a) != nil {
+		t.Errorf("Open() of the evicted repo = %v, %v", r, err)
+	}
+
+	if _, err := p.Open(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Open() of a missing repo succeeded")
+	}
+	if p.Len() != 2 {
+		t.Errorf("pool has %d repos after a failure, want 2", p.Len())
+	}
+}
+
+func TestPoolClosesAttachedResources(t *testing.T) {
+	dir := newPoolTestDir(t, "a", "b")
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	p := NewPool(1)
+	closed := make(chan string, 10)
+	closer := func(name string) *testCloser {
+		return &testCloser{name: name, closed: closed}
+	}
+
+	// the repo is opened to attach resources
+	ca := closer("a")
+	if err := p.Attach(a, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Attach(a, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Attach(a, closer("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if p.get(a) == nil {
+		t.Fatal("Attach() does not open the repo")
+	}
+	select {
+	case name := <-closed:
+		t.Fatalf("%s is closed before eviction", name)
+	default:
+	}
+
+	if _, err := p.Open(b); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-closed:
+			got[name]++
+		case <-time.After(time.Second):
+			t.Fatalf("closers are not called on eviction: %v", got)
+		}
+	}
+	if got["a"] != 1 || got["a2"] != 1 {
+		t.Errorf("closed %v, want a and a2 once", got)
+	}
+	select {
+	case name := <-closed:
+		t.Errorf("%s is closed twice", name)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if err := p.Attach(filepath.Join(dir, "missing"), closer("missing")); err == nil {
+		t.Error("Attach() to a missing repo succeeded")
+	}
+}
+
+func TestPoolOpensRepositoryLayouts(t *testing.T) {
+	dir := newPoolTestDir(t, "worktree")
+	defer os.RemoveAll(dir)
+	_, err := git.PlainInit(filepath.Join(dir, "bare"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a worktree whose .git file points to the .git directory of another one
+	linked := filepath.Join(dir, "linked")
+	err = os.Mkdir(linked, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(linked, ".git"), []byte("gitdir: ../worktree/.git\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPool(0)
+	for _, name := range []string{"worktree", "bare", "linked"} {
+		r, err := p.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Open(%s): %v", name, err)
+			continue
+		}
+		_, err = r.Worktree()
+		if (name == "bare") != (err == git.ErrIsBareRepository) {
+			t.Errorf("Worktree() of %s: %v", name, err)
+		}
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "invalid-link"), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "invalid-link", ".git"), []byte("worktree\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"missing", "invalid-link"} {
+		if _, err := p.Open(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Open(%s) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package repo
+
+// Reader is the read-only API of Repo for trees, files, blobs, commits and refs.
+// Services built on gitan can depend on it to be tested with fakes or repos on memory storage.
+type Reader interface {
+	GetTree(path string, rev string) ([]*TreeEntry, error)
+	Find(path string, rev string, maxDepth int) ([]*TreeEntry, error)
+	GetFileOpener(path string, rev string) (FileOpener, *FileStat, error)
+	GetFile(path string, rev string) ([]byte, *FileStat, error)
+	GetBlobOpener(hash string) (FileOpener, error)
+	GetBlob(hash string) ([]byte, error)
+	GetCommit(rev string) (*Commit, error)
+	GetCommitHash(rev string) (string, error)
+	GetLog(rev string, limit int) ([]*Commit, error)
+	GetBranches() ([]*Revision, error)
+	GetTags() ([]*Tag, error)
+	GetDiff(from string, to string, limit int) ([]*FileDiff, error)
+}
+
+var _ Reader = (*Repo)(nil)
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object/commitgraph"
+)
+
+// SetAllowedRefs restricts visible refs to ones whose full names match any of the glob patterns
+// (e.g. "refs/heads/main", "refs/tags/v*"). Commits are resolvable only if reachable from visible refs.
+// Empty patterns allow every ref.
+func (r *Repo) SetAllowedRefs(patterns []string) {
+	r.allowedRefs = patterns
+	// cached metadata may include invisible refs
+	r.metadataMutex.Lock()
+	r.metadata = nil
+	r.metadataMutex.Unlock()
+}
+
+func (r *Repo) isRefAllowed(name plumbing.ReferenceName) bool {
+	if len(r.allowedRefs) == 0 {
+		return true
+	}
+	for _, pattern := range r.allowedRefs {
+		if MatchGlob(pattern, name.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedRefTips returns commits of visible refs
+func (r *Repo) allowedRefTips() ([]plumbing.Hash, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return refTips(repository, r.isRefAllowed)
+}
+
+// isReachable reports whether the commit is reachable from visible refs
+func (r *Repo) isReachable(h plumbing.Hash) (bool, error) {
+	repository, err := r.open()
+	if err != nil {
+		return false, err
+	}
+	tips, err := r.allowedRefTips()
+	if err != nil {
+		return false, err
+	}
+	index := r.commitNodeIndex(repository)
+	target, err := index.Get(h)
+	if err != nil {
+		return false, errors.Wrap(err, "obtaining commit failed")
+	}
+	nodes := make([]commitgraph.CommitNode, 0, len(tips))
+	for _, tip := range tips {
+		node, err := index.Get(tip)
+		if err != nil {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return isAncestorNode(target, nodes, make(map[plumbing.Hash]bool))
+}
+
+// baseRevision returns the leading ref or hash part of a revision expression (e.g. "main" of "main~2")
+func baseRevision(rev string) string {
+	end := len(rev)
+	if i := strings.IndexAny(rev, "~^:"); i >= 0 && i < end {
+		end = i
+	}
+	if i := strings.Index(rev, "@{"); i >= 0 && i < end {
+		end = i
+	}
+	return rev[:end]
+}
+
+var errRevisionNotVisible = errors.New("revision is not visible")
+
+// resolveRevision resolves rev into a commit hash honoring allowed refs; results are cached for the ref TTL
+func (r *Repo) resolveRevision(rev string) (*plumbing.Hash, error) {
+	cacheKey := fmt.Sprintf("rev:%d:%s", r.id, rev)
+	if hash, ok := r.cache.getRef(cacheKey); ok {
+		h := plumbing.NewHash(hash)
+		return &h, nil
+	}
+	h, err := r.resolveVisibleRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.putRef(cacheKey, h.String())
+	return h, nil
+}
+
+func (r *Repo) resolveVisibleRevision(rev string) (*plumbing.Hash, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	h, err := repository.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving rev failed")
+	}
+	if len(r.allowedRefs) == 0 {
+		return h, nil
+	}
+	base := baseRevision(rev)
+	if base != "" && !fullHashPattern.MatchString(base) {
+		if ref := r.findReference(base); ref != nil {
+			if !r.isRefAllowed(ref.Name()) {
+				return nil, errors.Wrapf(errRevisionNotVisible, "resolving rev failed: %s", rev)
+			}
+			return h, nil
+		}
+	}
+	ok, err := r.isReachable(*h)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving rev failed")
+	}
+	if !ok {
+		return nil, errors.Wrapf(errRevisionNotVisible, "resolving rev failed: %s", rev)
+	}
+	return h, nil
+}
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// restrictedTestRepo has main and tag v1 visible, and branch secret and tag internal hidden:
+//
+//	c1 (v1) <- c2 (main) <- c3 (secret, internal)
+func restrictedTestRepo(t *testing.T) (*testRepo, []plumbing.Hash) {
+	tr := newTestRepo(t)
+	c1 := tr.commit("first", map[string]testFile{"a.txt": regular("a")})
+	c2 := tr.commit("second", map[string]testFile{"a.txt": regular("b")}, c1)
+	c3 := tr.commit("secret", map[string]testFile{"a.txt": regular("c")}, c2)
+	tr.setRef("refs/heads/main", c2)
+	tr.setRef("refs/heads/secret", c3)
+	tr.setRef("refs/tags/v1", c1)
+	tr.setRef("refs/tags/internal", c3)
+	return tr, []plumbing.Hash{c1, c2, c3}
+}
+
+var testAllowedRefs = []string{"refs/heads/main", "refs/tags/v*"}
+
+func TestAllowedRefsListing(t *testing.T) {
+	tr, _ := restrictedTestRepo(t)
+	r := tr.open()
+	r.SetAllowedRefs(testAllowedRefs)
+	branches, err := r.GetBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 1 || branches[0].Name != "refs/heads/main" {
+		t.Errorf("GetBranches() = %v, want only refs/heads/main", branches)
+	}
+	tags, err := r.GetTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "refs/tags/v1" {
+		t.Errorf("GetTags() = %v, want only refs/tags/v1", tags)
+	}
+}
+
+func TestAllowedRefsResolution(t *testing.T) {
+	tr, commits := restrictedTestRepo(t)
+	c1, c2, c3 := commits[0], commits[1], commits[2]
+	tests := []struct {
+		rev  string
+		want plumbing.Hash
+		// hidden means the revision must be refused as not visible
+		hidden bool
+	}{
+		{rev: "main", want: c2},
+		{rev: "refs/heads/main", want: c2},
+		{rev: "main~1", want: c1},
+		{rev: "main^", want: c1},
+		{rev: "v1", want: c1},
+		{rev: c2.String(), want: c2},
+		{rev: "secret", hidden: true},
+		{rev: "refs/heads/secret", hidden: true},
+		{rev: "secret~1", hidden: true},
+		{rev: "internal", hidden: true},
+		{rev: c3.String(), hidden: true},
+	}
+	r := tr.open()
+	r.SetAllowedRefs(testAllowedRefs)
+	for _, tt := range tests {
+		t.Run(tt.rev, func(t *testing.T) {
+			got, err := r.GetCommitHash(tt.rev)
+			if tt.hidden {
+				if errors.Cause(err) != errRevisionNotVisible {
+					t.Errorf("GetCommitHash(%q) = %q, %v, want errRevisionNotVisible", tt.rev, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want.String() {
+				t.Errorf("GetCommitHash(%q) = %q, %v, want %s", tt.rev, got, err, tt.want)
+			}
+		})
+	}
+	// every revision is visible without restrictions
+	r = tr.open()
+	for _, rev := range []string{"secret", "internal", c3.String()} {
+		if _, err := r.GetCommitHash(rev); err != nil {
+			t.Errorf("GetCommitHash(%q) without allowed refs: %v", rev, err)
+		}
+	}
+}
+
+func TestMetadataHidesInvisibleHead(t *testing.T) {
+	tr, _ := restrictedTestRepo(t)
+	tr.setRef("refs/heads/master", tr.commit("master", map[string]testFile{"a.txt": regular("m")}))
+	r := tr.open()
+	meta, err := r.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Head != "refs/heads/master" || meta.DefaultBranch != "master" || meta.HeadCommitID == "" {
+		t.Errorf("GetMetadata() = %+v, want HEAD of refs/heads/master", meta)
+	}
+	r.SetAllowedRefs(testAllowedRefs)
+	meta, err = r.GetMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Head != "" || meta.DefaultBranch != "" || meta.HeadCommitID != "" {
+		t.Errorf("GetMetadata() = %+v, want no HEAD", meta)
+	}
+	if meta.RefCount != 2 {
+		t.Errorf("GetMetadata().RefCount = %d, want 2", meta.RefCount)
+	}
+}
+
+func TestLFSObjectsOfRestrictedRepo(t *testing.T) {
+	contents := "large file\n"
+	oid := strings.Repeat("ab", 32)
+	gitDir, err := ioutil.TempDir("", "gitan-lfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gitDir)
+	path := filepath.Join(gitDir, "lfs", "objects", oid[0:2], oid[2:4], oid)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(contents), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newTestRepo(t)
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 11\n"
+	tr.setRef("refs/heads/main", tr.commit("lfs", map[string]testFile{"large.bin": regular(pointer)}))
+	r := tr.open()
+	r.gitDir = gitDir
+	if size, err := r.StatLFSObject(oid); err != nil || size != int64(len(contents)) {
+		t.Errorf("StatLFSObject() = %d, %v, want %d", size, err, len(contents))
+	}
+	r.SetAllowedRefs(testAllowedRefs)
+	if _, err := r.StatLFSObject(oid); err == nil {
+		t.Error("StatLFSObject() of restricted repo succeeded")
+	}
+	if reader, err := r.OpenLFSObject(oid); err == nil {
+		reader.Close()
+		t.Error("OpenLFSObject() of restricted repo succeeded")
+	}
+	// objects are still served through visible revisions
+	bs, stat, err := r.GetFile("large.bin", "main")
+	if err != nil || string(bs) != contents || stat.LFSOID != oid {
+		t.Errorf("GetFile() = %q, %+v, %v, want the LFS object", bs, stat, err)
+	}
+}
@@ -1,25 +1,59 @@
 package repo
 
 import (
-	"bytes"
-	"encoding/binary"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
 )
 
 // FileOpener is delayed file opener
 type FileOpener func() (io.ReadCloser, error)
 
+// lastRepoID is the ID of the latest constructed Repo
+var lastRepoID uint64
+
+func nextRepoID() uint64 {
+	return atomic.AddUint64(&lastRepoID, 1)
+}
+
 // GitRepo wraps Git repository
 type Repo struct {
+	// id distinguishes repos in caches; paths are not unique (e.g. empty for repos on memory storage)
+	id uint64
+	// repository is set if the repo is opened eagerly; otherwise it is obtained from pool on demand
 	repository *git.Repository
+	path       string
+	pool       *Pool
+	// gitDir is the .git directory (or the bare repository) which holds the LFS store
+	gitDir      string
+	allowedRefs []string
+	cache       *Cache
+	// commitGraphPath is the file of gitan's own commit graph used when the repository has none
+	commitGraphPath string
+	graphMutex      sync.Mutex
+	graphs          map[string]*loadedCommitGraph
+	backend         Backend
+	metadataMutex   sync.Mutex
+	metadata        *cachedMetadata
+}
+
+func findGitDir(repoPath string) string {
+	if fi, err := os.Stat(filepath.Join(repoPath, ".git")); err == nil && fi.IsDir() {
+		return filepath.Join(repoPath, ".git")
+	}
+	return repoPath
 }
 
 // NewRepo opens Git repository
@@ -29,17 +63,70 @@ func NewRepo(repoPath string) (*Repo, error) {
 		return nil, errors.Wrapf(err, "opening repo failed: %s", repoPath)
 	}
 	repo := Repo{
+		id:         nextRepoID(),
 		repository: r,
+		path:       repoPath,
+		gitDir:     findGitDir(repoPath),
 	}
 	return &repo, nil
 }
 
+// NewRepoWithStorer opens the repository stored in s (e.g. memory.NewStorage()).
+// Such repos have no LFS store nor commit-graph file and cannot use the git CLI backend.
+func NewRepoWithStorer(s storage.Storer) (*Repo, error) {
+	r, err := git.Open(s, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening repo failed")
+	}
+	return NewRepoWithRepository(r), nil
+}
+
+// NewRepoWithRepository wraps the opened go-git repository
+func NewRepoWithRepository(repository *git.Repository) *Repo {
+	return &Repo{id: nextRepoID(), repository: repository}
+}
+
+// NewLazyRepo registers Git repository which is opened through pool on first use
+func NewLazyRepo(repoPath string, pool *Pool) *Repo {
+	return &Repo{
+		id:     nextRepoID(),
+		path:   repoPath,
+		pool:   pool,
+		gitDir: findGitDir(repoPath),
+	}
+}
+
+// Path returns the path the repo was registered with
+func (r *Repo) Path() string {
+	return r.path
+}
+
+// ID returns the number identifying the repo in the process, which is unlike Path unique
+func (r *Repo) ID() uint64 {
+	return r.id
+}
+
+// GitDir returns the .git directory (or the bare repository)
+func (r *Repo) GitDir() string {
+	return r.gitDir
+}
+
+func (r *Repo) open() (*git.Repository, error) {
+	if r.repository != nil {
+		return r.repository, nil
+	}
+	return r.pool.Open(r.path)
+}
+
 type FileStat struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Mode     uint32 `json:"mode"`
-	Size     int64  `json:"size"`
-	IsBinary bool   `json:"is_binary"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Mode
+	Size     int64 `json:"size"`
+	IsBinary bool  `json:"is_binary"`
+	// LFSOID and LFSSize are set if the file is a Git LFS pointer
+	LFSOID  string `json:"lfs_oid,omitempty"`
+	LFSSize int64  `json:"lfs_size,omitempty"`
 }
 
 func NewFileStat(f *object.File) (*FileStat, error) {
@@ -47,38 +134,44 @@ func NewFileStat(f *object.File) (*FileStat, error) {
 	if err != nil {
 		return nil, err
 	}
-	buf := bytes.NewReader(f.Mode.Bytes())
-	var mode uint32
-	err = binary.Read(buf, binary.LittleEndian, &mode)
-	if err != nil {
-		return nil, err
-	}
-	return &FileStat{
+	stat := &FileStat{
 		ID:       f.ID().String(),
 		Name:     f.Name,
-		Mode:     mode,
+		Mode:     NewMode(f.Mode),
 		Size:     f.Size,
 		IsBinary: isBinary,
-	}, nil
+	}
+	if !isBinary && f.Size <= lfsPointerMaxSize {
+		contents, err := f.Contents()
+		if err != nil {
+			return nil, err
+		}
+		if pointer := ParseLFSPointer([]byte(contents)); pointer != nil {
+			stat.LFSOID = pointer.OID
+			stat.LFSSize = pointer.Size
+		}
+	}
+	return stat, nil
 }
 
 type TreeEntry struct {
 	Hash string `json:"hash"`
 	Name string `json:"name"`
-	Mode uint32 `json:"mode"`
+	Mode
+	// optional fields filled by ExpandTreeEntries
+	Size       *int64  `json:"size,omitempty"`
+	Type       Kind    `json:"type,omitempty"`
+	Target     string  `json:"target,omitempty"`
+	LastCommit *Commit `json:"last_commit,omitempty"`
+	// Submodule is set for gitlink entries
+	Submodule *Submodule `json:"submodule,omitempty"`
 }
 
 func NewTreeEntry(te *object.TreeEntry) (*TreeEntry, error) {
-	buf := bytes.NewReader(te.Mode.Bytes())
-	var mode uint32
-	err := binary.Read(buf, binary.LittleEndian, &mode)
-	if err != nil {
-		return nil, err
-	}
 	return &TreeEntry{
 		Hash: te.Hash.String(),
 		Name: te.Name,
-		Mode: mode,
+		Mode: NewMode(te.Mode),
 	}, nil
 }
 
@@ -93,102 +186,83 @@ func gitPathJoin(elems ...string) string {
 	return strings.Join(xs, sep)
 }
 
-func (r *Repo) Find(path string, rev string, maxDepth int) ([]*TreeEntry, error) {
-	results := make([]*TreeEntry, 0)
-	stack := []string{""}
-	for len(stack) > 0 {
-		idx := len(stack) - 1
-		if maxDepth > 0 && len(stack) > maxDepth {
-			stack = stack[:idx]
-			continue
-		}
-		p := stack[idx]
-		stack = stack[:idx]
-		treePath := gitPathJoin(path, p)
-		tes, err := r.GetTree(treePath, rev)
-		if err != nil {
-			return nil, err
-		}
-		for _, te := range tes {
-			childPath := gitPathJoin(p, te.Name)
-			if te.Mode&0040000 != 0 {
-				stack = append(stack, childPath)
-			}
-			results = append(results, &TreeEntry{
-				Hash: te.Hash,
-				Name: childPath,
-				Mode: te.Mode,
-			})
-		}
+func (r *Repo) resolveCommit(rev string) (*object.Commit, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
 	}
-	return results, nil
+	h, err := r.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	ci, err := repository.CommitObject(*h)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining commit failed")
+	}
+	return ci, nil
 }
 
 func (r *Repo) GetTree(path string, rev string) ([]*TreeEntry, error) {
-	h, err := r.repository.ResolveRevision(plumbing.Revision(rev))
+	h, err := r.resolveRevision(rev)
 	if err != nil {
-		return nil, errors.Wrap(err, "resolving rev failed")
+		return nil, err
 	}
-	ci, err := r.repository.CommitObject(*h)
-	if err != nil {
-		return nil, errors.Wrap(err, "obtaining commit failed")
+	return r.getTreeWithHash(h, path)
+}
+
+func (r *Repo) getTreeWithHash(h *plumbing.Hash, path string) ([]*TreeEntry, error) {
+	cacheKey := fmt.Sprintf("tree:%s:%s", h, path)
+	results := make([]*TreeEntry, 0)
+	if r.cache.Get(cacheKey, &results) {
+		return results, nil
 	}
-	tree, err := ci.Tree()
+	results, err := r.getBackend().Tree(*h, path)
 	if err != nil {
-		return nil, errors.Wrap(err, "obtaining tree from commit failed")
+		return nil, err
 	}
-	var targetTree *object.Tree = tree
-	if path != "" {
-		targetTree, err = tree.Tree(path)
+	for _, te := range results {
+		if te.Kind != KindSubmodule {
+			continue
+		}
+		// .gitmodules is read with go-git regardless of the backend
+		repository, err := r.open()
+		if err != nil {
+			return nil, err
+		}
+		ci, err := repository.CommitObject(*h)
 		if err != nil {
-			return nil, errors.Wrap(err, "obtaining file or directory failed")
+			return nil, errors.Wrap(err, "obtaining commit failed")
 		}
-	}
-	results := make([]*TreeEntry, 0)
-	for _, te := range targetTree.Entries {
-		result, err := NewTreeEntry(&te)
+		tree, err := ci.Tree()
 		if err != nil {
-			return nil, errors.Wrap(err, "invalid tree entry")
+			return nil, errors.Wrap(err, "obtaining tree from commit failed")
 		}
-		results = append(results, result)
+		err = fillSubmodules(tree, path, results)
+		if err != nil {
+			return nil, err
+		}
+		break
 	}
+	r.cache.Put(cacheKey, results)
 	return results, nil
 }
 
 // Get resolves revison and file name
 func (r *Repo) GetFileOpener(path string, rev string) (FileOpener, *FileStat, error) {
-	h, err := r.repository.ResolveRevision(plumbing.Revision(rev))
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "resolving rev failed")
-	}
-	ci, err := r.repository.CommitObject(*h)
+	h, err := r.resolveRevision(rev)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "obtaining commit failed")
+		return nil, nil, err
 	}
-	file, err := ci.File(path)
+	fileOpener, fileStat, err := r.getBackend().File(*h, path)
 	if err != nil {
-		tree, err := ci.Tree()
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "obtaining tree from commit failed")
-		} else {
-			_, err := tree.Tree(path)
-			if err != nil {
-				return nil, nil, errors.Wrap(err, "obtaining file or directory failed")
-			} else {
-				return nil, nil, errors.New("obtaining directory")
-			}
-		}
+		return nil, nil, err
 	}
-	fileOpener := func() (io.ReadCloser, error) {
-		r, err := file.Reader()
-		if err != nil {
-			return nil, errors.Wrap(err, "opening file failed")
+	if fileStat.LFSOID != "" {
+		// serve the real content if it exists in the local LFS store; the pointer is in a visible revision
+		if _, err := r.statLFSObject(fileStat.LFSOID); err == nil {
+			oid := fileStat.LFSOID
+			fileOpener = func() (io.ReadCloser, error) { return r.openLFSObject(oid) }
 		}
-		return r, nil
-	}
-	fileStat, err := NewFileStat(file)
-	if err != nil {
-		return nil, nil, err
 	}
 	return fileOpener, fileStat, nil
 }
@@ -211,11 +285,15 @@ func (r *Repo) GetFile(path string, rev string) ([]byte, *FileStat, error) {
 }
 
 func (r *Repo) GetBlobOpener(hash string) (FileOpener, error) {
-	blob, err := r.repository.BlobObject(plumbing.NewHash(hash))
-	if err != nil {
-		return nil, errors.Wrap(err, "obtaining blob object failed")
+	if len(r.allowedRefs) != 0 {
+		// reachability of blobs is too expensive to check
+		return nil, errors.New("obtaining blob by hash is not allowed when refs are restricted")
 	}
-	return func() (io.ReadCloser, error) { return blob.Reader() }, nil
+	return r.getBlobOpener(hash)
+}
+
+func (r *Repo) getBlobOpener(hash string) (FileOpener, error) {
+	return r.getBackend().Blob(plumbing.NewHash(hash))
 }
 
 func (r *Repo) GetBlob(hash string) ([]byte, error) {
@@ -223,6 +301,20 @@ func (r *Repo) GetBlob(hash string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return readAll(opener)
+}
+
+// GetListedBlob returns the blob whose hash was listed by Find or GetTree.
+// Unlike GetBlob, it does not refuse hashes when refs are restricted.
+func (r *Repo) GetListedBlob(hash string) ([]byte, error) {
+	opener, err := r.getBlobOpener(hash)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(opener)
+}
+
+func readAll(opener FileOpener) ([]byte, error) {
 	reader, err := opener()
 	if err != nil {
 		return nil, err
@@ -243,12 +335,19 @@ type Revision struct {
 }
 
 func (r *Repo) GetBranches() ([]*Revision, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
 	revs := make([]*Revision, 0)
-	refIter, err := r.repository.Branches()
+	refIter, err := repository.Branches()
 	if err != nil {
 		return nil, err
 	}
 	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if !r.isRefAllowed(ref.Name()) {
+			return nil
+		}
 		h := ref.Hash()
 		commit, err := r.getCommitWithHash(&h, false)
 		if err != nil || commit == nil {
@@ -269,16 +368,68 @@ func (r *Repo) GetBranches() ([]*Revision, error) {
 	return revs, nil
 }
 
-func (r *Repo) GetCommitHash(rev string) (string, error) {
-	h, err := r.repository.ResolveRevision(plumbing.Revision(rev))
+type Tag struct {
+	Name      string     `json:"name"`
+	ShortName string     `json:"short_name"`
+	CommitID  string     `json:"commit_id"`
+	Commit    *Commit    `json:"commit"`
+	Tagger    *Signature `json:"tagger"`
+	Message   string     `json:"message"`
+}
+
+func (r *Repo) GetTags() ([]*Tag, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]*Tag, 0)
+	refIter, err := repository.Tags()
+	if err != nil {
+		return nil, err
+	}
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if !r.isRefAllowed(ref.Name()) {
+			return nil
+		}
+		tag := Tag{
+			Name:      ref.Name().String(),
+			ShortName: ref.Name().Short(),
+		}
+		h := ref.Hash()
+		to, err := repository.TagObject(h)
+		if err == nil {
+			// annotated tag
+			tagger, _ := NewSignature(to.Tagger)
+			tag.Tagger = tagger
+			tag.Message = to.Message
+			ci, err := to.Commit()
+			if err != nil {
+				return nil
+			}
+			h = ci.Hash
+		}
+		commit, err := r.getCommitWithHash(&h, false)
+		if err != nil || commit == nil {
+			return nil
+		}
+		tag.CommitID = h.String()
+		tag.Commit = commit
+		tags = append(tags, &tag)
+		return nil
+	})
 	if err != nil {
-		return "", errors.Wrap(err, "resolving rev failed")
+		return nil, err
 	}
-	ci, err := r.repository.CommitObject(*h)
+	return tags, nil
+}
+
+// GetCommitHash resolves rev into the commit hash
+func (r *Repo) GetCommitHash(rev string) (string, error) {
+	h, err := r.resolveRevision(rev)
 	if err != nil {
-		return "", errors.Wrap(err, "obtaining commit failed")
+		return "", err
 	}
-	return ci.String(), nil
+	return h.String(), nil
 }
 
 type Commit struct {
@@ -305,15 +456,48 @@ func NewSignature(sign object.Signature) (*Signature, error) {
 }
 
 func (r *Repo) GetCommit(rev string) (*Commit, error) {
-	h, err := r.repository.ResolveRevision(plumbing.Revision(rev))
+	h, err := r.resolveRevision(rev)
 	if err != nil {
-		return nil, errors.Wrap(err, "resolving rev failed")
+		return nil, err
 	}
 	return r.getCommitWithHash(h, true)
 }
 
+// GetLog returns at most limit commits reachable from rev ordered by committer time
+func (r *Repo) GetLog(rev string, limit int) ([]*Commit, error) {
+	h, err := r.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := r.getBackend().Log(*h, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining log failed")
+	}
+	commits := make([]*Commit, 0, len(hashes))
+	for i := range hashes {
+		commit, err := r.getCommitWithHash(&hashes[i], false)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
 func (r *Repo) getCommitWithHash(hash *plumbing.Hash, fetchFiles bool) (*Commit, error) {
-	ci, err := r.repository.CommitObject(*hash)
+	cacheKey := fmt.Sprintf("commit:%s:%t", hash, fetchFiles)
+	var cached Commit
+	if r.cache.Get(cacheKey, &cached) {
+		if cached.ParentHashes == nil {
+			cached.ParentHashes = make([]string, 0)
+		}
+		return &cached, nil
+	}
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	ci, err := repository.CommitObject(*hash)
 	if err != nil {
 		return nil, errors.Wrap(err, "obtaining commit failed")
 	}
@@ -347,10 +531,14 @@ func (r *Repo) getCommitWithHash(hash *plumbing.Hash, fetchFiles bool) (*Commit,
 		ParentHashes: parentHashes,
 		Files:        files,
 	}
+	r.cache.Put(cacheKey, newCi)
 	return newCi, nil
 }
 
-// Close closes repository (do nothing)
+// Close stops processes of the backend if any; the repo can still be used and restarts them on demand
 func (r *Repo) Close() error {
+	if closer, ok := r.backend.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var fullHashPattern = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// kinds of resolved revisions
+const (
+	RevisionKindBranch     = "branch"
+	RevisionKindTag        = "tag"
+	RevisionKindRemote     = "remote"
+	RevisionKindNote       = "note"
+	RevisionKindRef        = "ref"
+	RevisionKindHash       = "hash"
+	RevisionKindExpression = "expression"
+)
+
+type ResolvedRevision struct {
+	Revision string `json:"revision"`
+	CommitID string `json:"commit_id"`
+	// RefName is the full name of the reference if the revision names one (HEAD is dereferenced)
+	RefName string `json:"ref_name,omitempty"`
+	// ObjectID and ObjectType describe the object which the revision points to before peeling (e.g. an annotated tag)
+	ObjectID   string `json:"object_id"`
+	ObjectType string `json:"object_type"`
+	Kind       string `json:"kind"`
+}
+
+func (r *Repo) findReference(rev string) *plumbing.Reference {
+	repository, err := r.open()
+	if err != nil {
+		return nil
+	}
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, rev))
+		ref, err := repository.Reference(name, false)
+		if err != nil {
+			continue
+		}
+		// dereference symbolic refs such as HEAD but keep the name of the target
+		for i := 0; ref.Type() == plumbing.SymbolicReference && i < 10; i++ {
+			target, err := repository.Reference(ref.Target(), false)
+			if err != nil {
+				return nil
+			}
+			ref = target
+		}
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		return ref
+	}
+	return nil
+}
+
+// ResolveRevision resolves rev into the commit hash and describes how it was resolved
+func (r *Repo) ResolveRevision(rev string) (*ResolvedRevision, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	h, err := r.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &ResolvedRevision{
+		Revision: rev,
+		CommitID: h.String(),
+		ObjectID: h.String(),
+		Kind:     RevisionKindExpression,
+	}
+	if fullHashPattern.MatchString(rev) {
+		resolved.Kind = RevisionKindHash
+	} else if ref := r.findReference(rev); ref != nil {
+		resolved.RefName = ref.Name().String()
+		resolved.ObjectID = ref.Hash().String()
+		switch {
+		case ref.Name().IsBranch():
+			resolved.Kind = RevisionKindBranch
+		case ref.Name().IsTag():
+			resolved.Kind = RevisionKindTag
+		case ref.Name().IsRemote():
+			resolved.Kind = RevisionKindRemote
+		case ref.Name().IsNote():
+			resolved.Kind = RevisionKindNote
+		default:
+			resolved.Kind = RevisionKindRef
+		}
+	}
+	obj, err := repository.Storer.EncodedObject(plumbing.AnyObject, plumbing.NewHash(resolved.ObjectID))
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining object failed")
+	}
+	resolved.ObjectType = obj.Type().String()
+	return resolved, nil
+}
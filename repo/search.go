@@ -0,0 +1,309 @@
+package repo
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// CommitQuery filters commits by their metadata; zero values match everything
+type CommitQuery struct {
+	// Message is a substring (or a regular expression if Regexp is set) of the commit message
+	Message    string
+	Regexp     bool
+	IgnoreCase bool
+	// Author and Committer are case-insensitive substrings of the name or the email
+	Author    string
+	Committer string
+	Since     time.Time
+	Until     time.Time
+}
+
+func matchSignature(sign *object.Signature, q string) bool {
+	if q == "" {
+		return true
+	}
+	q = strings.ToLower(q)
+	return strings.Contains(strings.ToLower(sign.Name), q) || strings.Contains(strings.ToLower(sign.Email), q)
+}
+
+func (q *CommitQuery) compile() (*regexp.Regexp, error) {
+	pattern := q.Message
+	if !q.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if q.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pattern")
+	}
+	return re, nil
+}
+
+// Validate reports errors of q which would make SearchCommits fail on any repo
+func (q *CommitQuery) Validate() error {
+	_, err := q.compile()
+	return err
+}
+
+// SearchCommits returns at most maxResults commits reachable from rev (or from all refs if rev is empty) matching q
+func (r *Repo) SearchCommits(rev string, q *CommitQuery, maxResults int) ([]*Commit, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	re, err := q.compile()
+	if err != nil {
+		return nil, err
+	}
+	match := func(ci *object.Commit) bool {
+		when := ci.Committer.When
+		if (!q.Since.IsZero() && when.Before(q.Since)) || (!q.Until.IsZero() && when.After(q.Until)) {
+			return false
+		}
+		if !matchSignature(&ci.Author, q.Author) || !matchSignature(&ci.Committer, q.Committer) {
+			return false
+		}
+		return re.MatchString(ci.Message)
+	}
+	if rev == "" && len(r.allowedRefs) != 0 {
+		return r.searchAllowedRefs(match, maxResults)
+	}
+	opts := &git.LogOptions{Order: git.LogOrderCommitterTime}
+	if rev == "" {
+		opts.All = true
+	} else {
+		ci, err := r.resolveCommit(rev)
+		if err != nil {
+			return nil, err
+		}
+		opts.From = ci.Hash
+	}
+	ciIter, err := repository.Log(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining log failed")
+	}
+	defer ciIter.Close()
+	commits := make([]*Commit, 0)
+	err = ciIter.ForEach(func(ci *object.Commit) error {
+		if maxResults > 0 && len(commits) >= maxResults {
+			return storer.ErrStop
+		}
+		if !match(ci) {
+			return nil
+		}
+		commit, err := r.getCommitWithHash(&ci.Hash, false)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// searchAllowedRefs walks history of each visible ref since LogOptions.All would include hidden ones
+func (r *Repo) searchAllowedRefs(match func(*object.Commit) bool, maxResults int) ([]*Commit, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	tips, err := r.allowedRefTips()
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining references failed")
+	}
+	seen := make(map[plumbing.Hash]bool)
+	matched := make([]*object.Commit, 0)
+	for _, tip := range tips {
+		ci, err := repository.CommitObject(tip)
+		if err != nil {
+			continue
+		}
+		err = object.NewCommitPreorderIter(ci, seen, nil).ForEach(func(ci *object.Commit) error {
+			seen[ci.Hash] = true
+			if match(ci) {
+				matched = append(matched, ci)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Committer.When.After(matched[j].Committer.When) })
+	if maxResults > 0 && len(matched) > maxResults {
+		matched = matched[:maxResults]
+	}
+	commits := make([]*Commit, 0, len(matched))
+	for _, ci := range matched {
+		commit, err := r.getCommitWithHash(&ci.Hash, false)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// PickaxeQuery selects commits whose changes touch Pattern, like `git log -S` (or `-G` if Regexp is set)
+type PickaxeQuery struct {
+	Pattern   string
+	Regexp    bool
+	PathGlobs []string
+}
+
+func fileContents(f *object.File) (string, bool, error) {
+	if f == nil {
+		return "", false, nil
+	}
+	isBinary, err := f.IsBinary()
+	if err != nil || isBinary {
+		return "", isBinary, err
+	}
+	s, err := f.Contents()
+	return s, false, err
+}
+
+// changeMatchesPickaxe reports whether the number of occurrences of pattern differs (-S),
+// or whether an added or removed line matches re (-G)
+func changeMatchesPickaxe(change *object.Change, q *PickaxeQuery, re *regexp.Regexp) (bool, error) {
+	if re == nil {
+		from, to, err := change.Files()
+		if err != nil {
+			return false, err
+		}
+		fromContents, fromBinary, err := fileContents(from)
+		if err != nil || fromBinary {
+			return false, err
+		}
+		toContents, toBinary, err := fileContents(to)
+		if err != nil || toBinary {
+			return false, err
+		}
+		return strings.Count(fromContents, q.Pattern) != strings.Count(toContents, q.Pattern), nil
+	}
+	patch, err := change.Patch()
+	if err != nil {
+		return false, err
+	}
+	for _, fp := range patch.FilePatches() {
+		if fp.IsBinary() {
+			continue
+		}
+		for _, chunk := range fp.Chunks() {
+			if chunk.Type() == diff.Equal {
+				continue
+			}
+			for _, line := range strings.Split(chunk.Content(), "\n") {
+				if re.MatchString(line) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func commitMatchesPickaxe(ci *object.Commit, q *PickaxeQuery, re *regexp.Regexp) (bool, error) {
+	// merge commits are not diffed, as git log does by default
+	if ci.NumParents() > 1 {
+		return false, nil
+	}
+	tree, err := ci.Tree()
+	if err != nil {
+		return false, err
+	}
+	var parentTree *object.Tree
+	if ci.NumParents() == 1 {
+		parent, err := ci.Parent(0)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return false, err
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return false, err
+	}
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if !matchAnyGlob(q.PathGlobs, name) {
+			continue
+		}
+		ok, err := changeMatchesPickaxe(change, q, re)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Pickaxe returns at most maxResults commits reachable from rev whose changes match q
+func (r *Repo) Pickaxe(rev string, q *PickaxeQuery, maxResults int) ([]*Commit, error) {
+	repository, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	var re *regexp.Regexp
+	if q.Regexp {
+		var err error
+		re, err = regexp.Compile(q.Pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid pattern")
+		}
+	}
+	ci, err := r.resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	ciIter, err := repository.Log(&git.LogOptions{From: ci.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, errors.Wrap(err, "obtaining log failed")
+	}
+	defer ciIter.Close()
+	commits := make([]*Commit, 0)
+	err = ciIter.ForEach(func(ci *object.Commit) error {
+		if maxResults > 0 && len(commits) >= maxResults {
+			return storer.ErrStop
+		}
+		ok, err := commitMatchesPickaxe(ci, q, re)
+		if err != nil {
+			return errors.Wrapf(err, "diffing commit failed: %s", ci.Hash)
+		}
+		if !ok {
+			return nil
+		}
+		commit, err := r.getCommitWithHash(&ci.Hash, false)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
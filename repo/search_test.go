@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPickaxe(t *testing.T) {
+	tr := newTestRepo(t)
+	files := map[string]testFile{
+		"a.txt": regular("one\nfoo\n"),
+	}
+	c1 := tr.commit("add foo", files)
+	files = map[string]testFile{
+		"a.txt": regular("two\nfoo\n"),
+	}
+	c2 := tr.commit("change another line", files, c1)
+	files = map[string]testFile{
+		"a.txt": regular("two\nfoo\nfoo bar\n"),
+	}
+	c3 := tr.commit("add another foo", files, c2)
+	files = map[string]testFile{
+		"a.txt": regular("two\n"),
+	}
+	c4 := tr.commit("remove foo", files, c3)
+	files = map[string]testFile{
+		"a.txt": regular("two\n"),
+		"b.md":  regular("fooo\n"),
+		"c.bin": regular("\x00foo"),
+	}
+	c5 := tr.commit("add foo to markdown and binary", files, c4)
+	tr.setRef("refs/heads/master", c5)
+	r := tr.open()
+
+	tests := []struct {
+		name       string
+		query      *PickaxeQuery
+		maxResults int
+		want       []string
+	}{
+		{
+			name:  "occurrences",
+			query: &PickaxeQuery{Pattern: "foo"},
+			want:  []string{c5.String(), c4.String(), c3.String(), c1.String()},
+		},
+		{
+			name:  "occurrences in paths",
+			query: &PickaxeQuery{Pattern: "foo", PathGlobs: []string{"*.txt"}},
+			want:  []string{c4.String(), c3.String(), c1.String()},
+		},
+		{
+			name:  "changed lines",
+			query: &PickaxeQuery{Pattern: "^fo+ bar$", Regexp: true},
+			want:  []string{c4.String(), c3.String()},
+		},
+		{
+			name:  "added or removed lines",
+			query: &PickaxeQuery{Pattern: "^one$", Regexp: true},
+			want:  []string{c2.String(), c1.String()},
+		},
+		{
+			name:       "max results",
+			query:      &PickaxeQuery{Pattern: "foo"},
+			maxResults: 2,
+			want:       []string{c5.String(), c4.String()},
+		},
+		{
+			name:  "no matches",
+			query: &PickaxeQuery{Pattern: "baz"},
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := r.Pickaxe("master", tt.query, tt.maxResults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(commits))
+			for _, commit := range commits {
+				got = append(got, commit.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pickaxe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := r.Pickaxe("master", &PickaxeQuery{Pattern: "(", Regexp: true}, 0); err == nil {
+		t.Error("Pickaxe() with an invalid regexp succeeded")
+	}
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+type Submodule struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	URL      string `json:"url"`
+	Branch   string `json:"branch,omitempty"`
+	CommitID string `json:"commit_id"`
+	// Site, User and Repo locate the submodule repository when it is hosted by the same server
+	Site string `json:"site,omitempty"`
+	User string `json:"user,omitempty"`
+	Repo string `json:"repo,omitempty"`
+}
+
+// readModules parses .gitmodules in the root tree and returns submodules keyed by path
+func readModules(root *object.Tree) (map[string]*config.Submodule, error) {
+	modules := make(map[string]*config.Submodule)
+	f, err := root.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return modules, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "obtaining .gitmodules failed")
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading .gitmodules failed")
+	}
+	m := config.NewModules()
+	err = m.Unmarshal([]byte(contents))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing .gitmodules failed")
+	}
+	for _, sm := range m.Submodules {
+		modules[sm.Path] = sm
+	}
+	return modules, nil
+}
+
+func newSubmodule(modules map[string]*config.Submodule, path string, commitID string) *Submodule {
+	submodule := &Submodule{
+		Name:     path,
+		Path:     path,
+		CommitID: commitID,
+	}
+	if sm := modules[path]; sm != nil {
+		submodule.Name = sm.Name
+		submodule.URL = sm.URL
+		submodule.Branch = sm.Branch
+	}
+	return submodule
+}
+
+// fillSubmodules sets submodule information of gitlink entries listed in dir
+func fillSubmodules(root *object.Tree, dir string, tes []*TreeEntry) error {
+	var modules map[string]*config.Submodule
+	for _, te := range tes {
+		if te.Kind != KindSubmodule {
+			continue
+		}
+		if modules == nil {
+			var err error
+			modules, err = readModules(root)
+			if err != nil {
+				return err
+			}
+		}
+		te.Submodule = newSubmodule(modules, gitPathJoin(dir, te.Name), te.Hash)
+	}
+	return nil
+}
+
+// FindSubmodule returns the submodule containing path at rev and the rest of path inside it.
+// It returns nil if path does not cross a submodule.
+func (r *Repo) FindSubmodule(rev string, path string) (*Submodule, string, error) {
+	ci, err := r.resolveCommit(rev)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := ci.Tree()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "obtaining tree from commit failed")
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		te, err := root.FindEntry(prefix)
+		if err != nil {
+			return nil, "", nil
+		}
+		if te.Mode == filemode.Submodule {
+			modules, err := readModules(root)
+			if err != nil {
+				return nil, "", err
+			}
+			return newSubmodule(modules, prefix, te.Hash.String()), strings.Join(parts[i:], "/"), nil
+		}
+		if te.Mode != filemode.Dir {
+			return nil, "", nil
+		}
+	}
+	return nil, "", nil
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// maxSymlinkHops is the number of symlinks followed before a loop is assumed (same as Linux)
+const maxSymlinkHops = 40
+
+func (r *Repo) readSymlink(te *object.TreeEntry) (string, error) {
+	repository, err := r.open()
+	if err != nil {
+		return "", err
+	}
+	blob, err := repository.BlobObject(te.Hash)
+	if err != nil {
+		return "", err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	bs, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// ResolveSymlinks resolves symlinks in path within the tree at rev.
+// Absolute targets and targets outside of the repository are refused.
+func (r *Repo) ResolveSymlinks(path string, rev string) (string, error) {
+	ci, err := r.resolveCommit(rev)
+	if err != nil {
+		return "", err
+	}
+	root, err := ci.Tree()
+	if err != nil {
+		return "", errors.Wrap(err, "obtaining tree from commit failed")
+	}
+	parts := strings.Split(path, "/")
+	resolved := make([]string, 0, len(parts))
+	hops := 0
+	for len(parts) > 0 {
+		name := parts[0]
+		parts = parts[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", errors.Errorf("symlink escapes repository: %s", path)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		current := gitPathJoin(append(resolved, name)...)
+		te, err := root.FindEntry(current)
+		if err != nil {
+			return "", errors.Wrapf(err, "obtaining file or directory failed: %s", current)
+		}
+		if te.Mode != filemode.Symlink {
+			resolved = append(resolved, name)
+			continue
+		}
+		hops++
+		if hops > maxSymlinkHops {
+			return "", errors.Errorf("too many levels of symlinks: %s", path)
+		}
+		target, err := r.readSymlink(te)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading symlink failed: %s", current)
+		}
+		if strings.HasPrefix(target, "/") {
+			return "", errors.Errorf("symlink escapes repository: %s -> %s", current, target)
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return gitPathJoin(resolved...), nil
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSymlinks(t *testing.T) {
+	tr := newTestRepo(t)
+	tr.setRef("refs/heads/master", tr.commit("symlinks", map[string]testFile{
+		"README.md":          regular("readme"),
+		"docs/index.md":      regular("index"),
+		"docs/readme":        symlink("../README.md"),
+		"docs/self":          symlink("."),
+		"link-to-docs":       symlink("docs"),
+		"link-to-link":       symlink("link-to-docs/readme"),
+		"nested/deep/up":     symlink("../../docs/index.md"),
+		"escape/parent":      symlink("../../etc/passwd"),
+		"escape/absolute":    symlink("/etc/passwd"),
+		"escape/via-link":    symlink("../link-to-docs/../../x"),
+		"loop/a":             symlink("b"),
+		"loop/b":             symlink("a"),
+		"broken":             symlink("missing"),
+		"dir-link/file.txt":  regular("file"),
+		"through/dir":        symlink("../dir-link"),
+		"through/dir-parent": symlink("../docs/self/../README.md"),
+	}))
+	r := tr.open()
+	tests := []struct {
+		path string
+		want string
+		// err is a substring of the error; empty means no error
+		err string
+	}{
+		{path: "README.md", want: "README.md"},
+		{path: "docs/readme", want: "README.md"},
+		{path: "link-to-docs/index.md", want: "docs/index.md"},
+		{path: "link-to-link", want: "README.md"},
+		{path: "nested/deep/up", want: "docs/index.md"},
+		{path: "through/dir/file.txt", want: "dir-link/file.txt"},
+		{path: "through/dir-parent", want: "README.md"},
+		{path: "./docs/../README.md", want: "README.md"},
+		{path: "../README.md", err: "escapes repository"},
+		{path: "escape/parent", err: "escapes repository"},
+		{path: "escape/absolute", err: "escapes repository"},
+		{path: "escape/via-link", err: "escapes repository"},
+		{path: "loop/a", err: "too many levels of symlinks"},
+		{path: "broken", err: "obtaining file or directory failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := r.ResolveSymlinks(tt.path, "master")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ResolveSymlinks(%q) = %q, %v, want error %q", tt.path, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveSymlinks(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
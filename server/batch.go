@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+const batchMaxObjects = 1000
+
+// batchMaxSize is the total size of contents embedded in a JSON response
+var batchMaxSize = 64 << 20
+
+// BatchObject identifies a file by Rev (the default branch if empty) and Path, or a blob by Hash
+type BatchObject struct {
+	Rev  string `json:"rev,omitempty"`
+	Path string `json:"path,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type BatchRequest struct {
+	Objects []*BatchObject `json:"objects"`
+}
+
+// BatchResult is the content of a BatchObject; Stat is set for files only and Content is base64 encoded in JSON
+type BatchResult struct {
+	BatchObject
+	Stat    *repo.FileStat `json:"stat,omitempty"`
+	Content []byte         `json:"content,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// open returns the content of the object; files without Rev are read at defaultRev
+func (obj *BatchObject) open(r *repo.Repo, defaultRev string) (repo.FileOpener, *repo.FileStat, error) {
+	switch {
+	case obj.Hash != "" && obj.Path == "":
+		opener, err := r.GetBlobOpener(obj.Hash)
+		return opener, nil, err
+	case obj.Hash == "" && obj.Path != "":
+		rev := obj.Rev
+		if rev == "" {
+			rev = defaultRev
+		}
+		return r.GetFileOpener(strings.TrimLeft(obj.Path, "/"), rev)
+	default:
+		return nil, nil, fmt.Errorf("either path or hash must be specified")
+	}
+}
+
+// wantsMultipart reports whether the client requested a multipart/mixed stream
+func wantsMultipart(c *gin.Context) bool {
+	return c.Query("format") == "multipart" || strings.Contains(c.GetHeader("Accept"), "multipart/mixed")
+}
+
+// batchHandler returns contents of many files at once as JSON, or as a multipart/mixed stream whose
+// parts have X-Gitan-Index, X-Gitan-Stat (JSON) or X-Gitan-Error headers
+func batchHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		defaultRev := user.RepoSettings(repoName).defaultRev()
+		var req BatchRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.JSON(400, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		if len(req.Objects) > batchMaxObjects {
+			c.JSON(400, gin.H{"ok": false, "error": fmt.Sprintf("too many objects: %d > %d", len(req.Objects), batchMaxObjects)})
+			return
+		}
+		if wantsMultipart(c) {
+			writeBatchMultipart(c, r, req.Objects, defaultRev)
+			return
+		}
+		results := make([]*BatchResult, 0, len(req.Objects))
+		total := 0
+		for _, obj := range req.Objects {
+			result := &BatchResult{BatchObject: *obj}
+			results = append(results, result)
+			opener, stat, err := obj.open(r, defaultRev)
+			if err == nil {
+				result.Stat = stat
+				result.Content, err = readOpener(opener, batchMaxSize-total)
+			}
+			if err != nil {
+				result.Error = err.Error()
+				continue
+			}
+			total += len(result.Content)
+		}
+		c.JSON(200, gin.H{"ok": true, "objects": results})
+	}
+}
+
+// readOpener reads at most max bytes of the content
+func readOpener(opener repo.FileOpener, max int) ([]byte, error) {
+	reader, err := opener()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	bs, err := ioutil.ReadAll(io.LimitReader(reader, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) > max {
+		return nil, fmt.Errorf("batch size limit exceeded: %d bytes", batchMaxSize)
+	}
+	return bs, nil
+}
+
+func writeBatchMultipart(c *gin.Context, r *repo.Repo, objects []*BatchObject, defaultRev string) {
+	mw := multipart.NewWriter(c.Writer)
+	c.Header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	c.Status(200)
+	for i, obj := range objects {
+		header := textproto.MIMEHeader{}
+		header.Set("X-Gitan-Index", strconv.Itoa(i))
+		opener, stat, err := obj.open(r, defaultRev)
+		var reader io.ReadCloser
+		if err == nil {
+			reader, err = opener()
+		}
+		if err != nil {
+			header.Set("X-Gitan-Error", err.Error())
+			if _, err := mw.CreatePart(header); err != nil {
+				return
+			}
+			continue
+		}
+		header.Set("Content-Type", "application/octet-stream")
+		if stat != nil {
+			bs, _ := json.Marshal(stat)
+			header.Set("X-Gitan-Stat", string(bs))
+			header.Set("Content-Type", contentType(obj.Path, stat))
+		}
+		part, err := mw.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+	mw.Close()
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type batchResponse struct {
+	OK      bool           `json:"ok"`
+	Error   string         `json:"error"`
+	Objects []*BatchResult `json:"objects"`
+}
+
+func newBatchTestServer(t *testing.T, settings *RepoSettings) (*Server, string) {
+	s := newTestServer()
+	mr := newMemoryRepo(t)
+	mr.setRef("refs/heads/main", mr.commit("c1", map[string]string{"a.txt": "old\n"}))
+	mr.commit("c2", map[string]string{"a.txt": "new\n", "dir/b.txt": "bravo\n"})
+	r := mr.open()
+	_, stat, err := r.GetFile("a.txt", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddRepo("s", "u", "r", r, settings)
+	return s, stat.ID
+}
+
+func batchBody(t *testing.T, objects ...*BatchObject) string {
+	bs, err := json.Marshal(&BatchRequest{Objects: objects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestBatchHandler(t *testing.T) {
+	s, hash := newBatchTestServer(t, &RepoSettings{DefaultBranch: "main"})
+	router := s.Router()
+	var res batchResponse
+	w := request(t, router, "POST", "/s/u/r/batch", batchBody(t,
+		&BatchObject{Path: "a.txt"},
+		&BatchObject{Rev: "master", Path: "/dir/b.txt"},
+		&BatchObject{Hash: hash},
+		&BatchObject{Rev: "master", Path: "missing.txt"},
+		&BatchObject{Rev: "master", Path: "a.txt", Hash: hash},
+	), &res)
+	if w.Code != 200 || !res.OK || len(res.Objects) != 5 {
+		t.Fatalf("POST batch = %d %s", w.Code, w.Body.String())
+	}
+	// files without revisions are read at the default branch
+	if o := res.Objects[0]; string(o.Content) != "old\n" || o.Stat == nil || o.Error != "" {
+		t.Errorf("objects[0] = %+v", o)
+	}
+	if o := res.Objects[1]; string(o.Content) != "bravo\n" || o.Stat == nil || o.Stat.Size != 6 || o.Path != "/dir/b.txt" {
+		t.Errorf("objects[1] = %+v", o)
+	}
+	if o := res.Objects[2]; string(o.Content) != "new\n" || o.Stat != nil || o.Hash != hash {
+		t.Errorf("objects[2] = %+v", o)
+	}
+	for _, o := range res.Objects[3:] {
+		if o.Error == "" || len(o.Content) != 0 {
+			t.Errorf("object = %+v, want an error", o)
+		}
+	}
+
+	objects := make([]*BatchObject, batchMaxObjects+1)
+	for i := range objects {
+		objects[i] = &BatchObject{Path: "a.txt"}
+	}
+	res = batchResponse{}
+	w = request(t, router, "POST", "/s/u/r/batch", batchBody(t, objects...), &res)
+	if w.Code != 400 || !strings.Contains(res.Error, "too many objects") {
+		t.Errorf("POST batch of too many objects = %d %s", w.Code, w.Body.String())
+	}
+	w = request(t, router, "POST", "/s/u/r/batch", "{", nil)
+	if w.Code != 400 {
+		t.Errorf("POST batch of invalid JSON = %d, want 400", w.Code)
+	}
+}
+
+func TestBatchHandlerSizeLimit(t *testing.T) {
+	defer func(size int) { batchMaxSize = size }(batchMaxSize)
+	batchMaxSize = 8
+	s, _ := newBatchTestServer(t, nil)
+	var res batchResponse
+	w := request(t, s.Router(), "POST", "/s/u/r/batch", batchBody(t,
+		&BatchObject{Rev: "master", Path: "a.txt"},
+		&BatchObject{Rev: "master", Path: "dir/b.txt"},
+		&BatchObject{Rev: "main", Path: "a.txt"},
+	), &res)
+	if w.Code != 200 || len(res.Objects) != 3 {
+		t.Fatalf("POST batch = %d %s", w.Code, w.Body.String())
+	}
+	// the total of contents is limited; objects after the limit may fit the rest
+	if o := res.Objects[0]; string(o.Content) != "new\n" {
+		t.Errorf("objects[0] = %+v", o)
+	}
+	if o := res.Objects[1]; len(o.Content) != 0 || !strings.Contains(o.Error, "batch size limit exceeded") {
+		t.Errorf("objects[1] = %+v, want the size limit exceeded", o)
+	}
+	if o := res.Objects[2]; string(o.Content) != "old\n" {
+		t.Errorf("objects[2] = %+v", o)
+	}
+}
+
+func TestBatchHandlerMultipart(t *testing.T) {
+	s, _ := newBatchTestServer(t, &RepoSettings{DefaultBranch: "main"})
+	router := s.Router()
+	for _, tt := range []struct {
+		path   string
+		accept string
+	}{
+		{"/s/u/r/batch?format=multipart", ""},
+		{"/s/u/r/batch", "multipart/mixed"},
+	} {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(batchBody(t,
+			&BatchObject{Path: "a.txt"},
+			&BatchObject{Rev: "master", Path: "missing.txt"},
+			&BatchObject{Rev: "master", Path: "dir/b.txt"},
+		)))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if w.Code != 200 || err != nil || mediaType != "multipart/mixed" {
+			t.Fatalf("POST %s = %d %q", tt.path, w.Code, w.Header().Get("Content-Type"))
+		}
+		mr := multipart.NewReader(w.Body, params["boundary"])
+		parts := make([]string, 0)
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			bs, err := ioutil.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts = append(parts, fmt.Sprintf("%s %t %t %q",
+				part.Header.Get("X-Gitan-Index"), part.Header.Get("X-Gitan-Stat") != "", part.Header.Get("X-Gitan-Error") != "", bs))
+		}
+		want := []string{`0 true false "old\n"`, `1 false true ""`, `2 true false "bravo\n"`}
+		if strings.Join(parts, ", ") != strings.Join(want, ", ") {
+			t.Errorf("POST %s = %v, want %v", tt.path, parts, want)
+		}
+	}
+}
+
+func TestBatchHandlerOfRestrictedRepo(t *testing.T) {
+	s, hash := newBatchTestServer(t, &RepoSettings{AllowedRefs: []string{"refs/heads/main"}, DefaultBranch: "main"})
+	var res batchResponse
+	w := request(t, s.Router(), "POST", "/s/u/r/batch", batchBody(t,
+		&BatchObject{Hash: hash},
+		&BatchObject{Rev: "master", Path: "a.txt"},
+		&BatchObject{Path: "a.txt"},
+	), &res)
+	if w.Code != 200 || len(res.Objects) != 3 {
+		t.Fatalf("POST batch = %d %s", w.Code, w.Body.String())
+	}
+	for i, o := range res.Objects[:2] {
+		if o.Error == "" || len(o.Content) != 0 {
+			t.Errorf("objects[%d] = %+v, want refused", i, o)
+		}
+	}
+	if o := res.Objects[2]; string(o.Content) != "old\n" {
+		t.Errorf("objects[2] = %+v, want the file of the allowed default branch", o)
+	}
+}
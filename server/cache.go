@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+type CacheConfig struct {
+	// MaxSize is the size of the in-memory cache in bytes
+	MaxSize int64 `json:"max_size" toml:"max_size"`
+	// Path is the directory to persist trees and commits; empty disables the on-disk cache
+	Path string `json:"path" toml:"path"`
+	// RefTTL is the lifetime in seconds of ref resolution results
+	RefTTL int `json:"ref_ttl" toml:"ref_ttl"`
+}
+
+func newCache(conf *CacheConfig) (*repo.Cache, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	return repo.NewCache(conf.MaxSize, conf.Path, time.Duration(conf.RefTTL)*time.Second)
+}
+
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (s *Server) lookupRepo(c *gin.Context) *repo.Repo {
+	site := s.Sites[c.Param("siteName")]
+	if site == nil {
+		return nil
+	}
+	user := site.UserRegistries[c.Param("userName")]
+	if user == nil {
+		return nil
+	}
+	return user.Repos[c.Param("repoName")]
+}
+
+// cacheResponse wraps the handler of the route with :rev to cache its successful responses
+// keyed by the resolved commit hash, so cached responses are valid as long as the server runs
+func cacheResponse(s *Server, route string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := s.lookupRepo(c)
+		// streamed responses are not buffered
+		if s.Cache == nil || r == nil || wantsNDJSON(c) {
+			handler(c)
+			return
+		}
+		hash, err := r.GetCommitHash(c.Param("rev"))
+		if err != nil {
+			handler(c)
+			return
+		}
+		key := strings.Join([]string{"response", strconv.FormatUint(r.ID(), 10), route, hash, c.Param("path"), c.Request.URL.RawQuery}, "\x00")
+		if data, ok := s.Cache.GetBytes(key); ok {
+			// the first line is the content type
+			i := bytes.IndexByte(data, '\n')
+			c.Data(200, string(data[:i]), data[i+1:])
+			return
+		}
+		w := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		handler(c)
+		if w.Status() == 200 {
+			data := append([]byte(w.Header().Get("Content-Type")+"\n"), w.body.Bytes()...)
+			s.Cache.PutBytes(key, data)
+		}
+	}
+}
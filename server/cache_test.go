@@ -0,0 +1,43 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/taskie/gitan/repo"
+)
+
+func TestResponseCacheOfReposOnMemory(t *testing.T) {
+	cache, err := repo.NewCache(0, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer()
+	s.Cache = cache
+	commits := make(map[string]string)
+	for _, name := range []string{"a", "b"} {
+		mr := newMemoryRepo(t)
+		commits[name] = mr.commit(name, map[string]string{name + ".txt": name}).String()
+		s.AddRepo("s", "u", name, mr.open(), nil)
+	}
+	router := s.Router()
+	// request twice so that the second one is served from the cache
+	for i := 0; i < 2; i++ {
+		for name, commit := range commits {
+			var resp struct {
+				OK      bool           `json:"ok"`
+				Commits []*repo.Commit `json:"commits"`
+			}
+			w := get(t, router, "/s/u/"+name+"/log/master", &resp)
+			if w.Code != 200 || len(resp.Commits) != 1 || resp.Commits[0].ID != commit {
+				t.Errorf("log of %s: %d %s, want %s", name, w.Code, w.Body.String(), commit)
+			}
+			var tree struct {
+				Entries []*repo.TreeEntry `json:"entries"`
+			}
+			w = get(t, router, "/s/u/"+name+"/tree/master/", &tree)
+			if w.Code != 200 || len(tree.Entries) != 1 || tree.Entries[0].Name != name+".txt" {
+				t.Errorf("tree of %s: %d %s", name, w.Code, w.Body.String())
+			}
+		}
+	}
+}
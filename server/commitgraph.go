@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/url"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultCommitGraphRefreshInterval = 10 * time.Minute
+
+type CommitGraphConfig struct {
+	// Path is the directory to store commit graphs of repos
+	Path string `json:"path" toml:"path"`
+	// RefreshInterval is the interval in seconds to check whether refs have moved
+	RefreshInterval int `json:"refresh_interval" toml:"refresh_interval"`
+}
+
+func commitGraphPath(conf *CommitGraphConfig, siteName, userName, repoName string) string {
+	if conf == nil || conf.Path == "" {
+		return ""
+	}
+	return filepath.Join(conf.Path, url.PathEscape(siteName), url.PathEscape(userName), url.PathEscape(repoName)+".graph")
+}
+
+func (s *Server) updateCommitGraphs() {
+	for siteName, site := range s.Sites {
+		for userName, user := range site.UserRegistries {
+			for repoName, r := range user.Repos {
+				err := r.UpdateCommitGraph()
+				if err != nil {
+					log.Warnf("writing commit graph of %s/%s/%s failed: %s", siteName, userName, repoName, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) runCommitGraphWriter() {
+	for {
+		s.updateCommitGraphs()
+		time.Sleep(s.CommitGraphRefreshInterval)
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+const feedLimit = 50
+
+type feedItem struct {
+	ID      string
+	Title   string
+	Link    string
+	Author  *repo.Signature
+	Updated time.Time
+	Content string
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Link    []*atomLink  `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    *atomLink   `xml:"link"`
+	Author  *atomPerson `xml:"author"`
+	Content *atomText   `xml:"content"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name    `xml:"rss"`
+	Version string      `xml:"version,attr"`
+	Channel *rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Body        string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Author      string   `xml:"author,omitempty"`
+	GUID        *rssGUID `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func requestURL(c *gin.Context) string {
+	return requestOrigin(c) + c.Request.URL.RequestURI()
+}
+
+func (s *Server) absoluteURL(c *gin.Context, elems ...string) string {
+	return requestOrigin(c) + s.BathPath + strings.Join(elems, "/")
+}
+
+func commitTitle(message string) string {
+	return strings.SplitN(strings.TrimSpace(message), "\n", 2)[0]
+}
+
+func commitFeedItems(s *Server, c *gin.Context, siteName, userName, repoName string, commits []*repo.Commit) []*feedItem {
+	items := make([]*feedItem, 0, len(commits))
+	for _, ci := range commits {
+		link := s.absoluteURL(c, siteName, userName, repoName, "commit", ci.ID)
+		items = append(items, &feedItem{
+			ID:      link,
+			Title:   fmt.Sprintf("%s/%s: %s", userName, repoName, commitTitle(ci.Message)),
+			Link:    link,
+			Author:  ci.Author,
+			Updated: ci.Committer.When,
+			Content: ci.Message,
+		})
+	}
+	return items
+}
+
+func tagFeedItems(s *Server, c *gin.Context, siteName, userName, repoName string, tags []*repo.Tag) []*feedItem {
+	items := make([]*feedItem, 0, len(tags))
+	for _, tag := range tags {
+		link := s.absoluteURL(c, siteName, userName, repoName, "tree", tag.ShortName, "")
+		item := &feedItem{
+			ID:      s.absoluteURL(c, siteName, userName, repoName, "tags", tag.ShortName, tag.CommitID),
+			Title:   fmt.Sprintf("%s/%s: %s", userName, repoName, tag.ShortName),
+			Link:    link,
+			Author:  tag.Commit.Author,
+			Updated: tag.Commit.Committer.When,
+			Content: tag.Commit.Message,
+		}
+		if tag.Tagger != nil {
+			item.Author = tag.Tagger
+			item.Updated = tag.Tagger.When
+			item.Content = tag.Message
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func repoFeedItems(s *Server, c *gin.Context, siteName, userName, repoName string, r *repo.Repo, settings *RepoSettings) ([]*feedItem, error) {
+	commits, err := r.GetLog(settings.defaultRev(), feedLimit)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.GetTags()
+	if err != nil {
+		return nil, err
+	}
+	items := commitFeedItems(s, c, siteName, userName, repoName, commits)
+	items = append(items, tagFeedItems(s, c, siteName, userName, repoName, tags)...)
+	return items, nil
+}
+
+func userFeedItems(s *Server, c *gin.Context, siteName, userName string, user *UserRegistry) []*feedItem {
+	items := make([]*feedItem, 0)
+	for repoName, r := range user.Repos {
+		settings := user.RepoSettings(repoName)
+		// items link to commits and trees, which blob-only and static repos do not serve
+		if settings.Hidden || s.isBlobOnly(settings) || s.isStatic(settings) {
+			continue
+		}
+		repoItems, err := repoFeedItems(s, c, siteName, userName, repoName, r, settings)
+		if err != nil {
+			// empty or broken repos must not break the aggregated feed
+			continue
+		}
+		items = append(items, repoItems...)
+	}
+	return items
+}
+
+func feedFormat(name string) (string, string) {
+	for _, format := range []string{"atom", "rss"} {
+		if strings.HasSuffix(name, "."+format) {
+			return strings.TrimSuffix(name, "."+format), format
+		}
+	}
+	return name, ""
+}
+
+func writeFeed(c *gin.Context, format string, title string, link string, items []*feedItem) {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Updated.After(items[j].Updated) })
+	if len(items) > feedLimit {
+		items = items[:feedLimit]
+	}
+	var updated time.Time
+	if len(items) > 0 {
+		updated = items[0].Updated
+	}
+	switch format {
+	case "atom":
+		entries := make([]*atomEntry, 0, len(items))
+		for _, item := range items {
+			entry := &atomEntry{
+				ID:      item.ID,
+				Title:   item.Title,
+				Updated: item.Updated.Format(time.RFC3339),
+				Link:    &atomLink{Href: item.Link, Rel: "alternate"},
+				Content: &atomText{Type: "text", Body: item.Content},
+			}
+			if item.Author != nil {
+				entry.Author = &atomPerson{Name: item.Author.Name, Email: item.Author.Email}
+			}
+			entries = append(entries, entry)
+		}
+		c.XML(200, &atomFeed{
+			ID:      link,
+			Title:   title,
+			Updated: updated.Format(time.RFC3339),
+			Link:    []*atomLink{{Href: link, Rel: "self"}},
+			Entries: entries,
+		})
+	case "rss":
+		rssItems := make([]*rssItem, 0, len(items))
+		for _, item := range items {
+			rssItem := &rssItem{
+				Title:       item.Title,
+				Link:        item.Link,
+				Description: item.Content,
+				GUID:        &rssGUID{IsPermaLink: false, Body: item.ID},
+				PubDate:     item.Updated.Format(time.RFC1123Z),
+			}
+			if item.Author != nil {
+				rssItem.Author = fmt.Sprintf("%s (%s)", item.Author.Email, item.Author.Name)
+			}
+			rssItems = append(rssItems, rssItem)
+		}
+		c.XML(200, &rssFeed{
+			Version: "2.0",
+			Channel: &rssChannel{
+				Title:         title,
+				Link:          link,
+				Description:   title,
+				LastBuildDate: updated.Format(time.RFC1123Z),
+				Items:         rssItems,
+			},
+		})
+	default:
+		c.JSON(404, gin.H{"ok": false, "error": fmt.Sprintf("unknown feed format: %s", format)})
+	}
+}
+
+func commitsFeedHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		branch, format := feedFormat(strings.TrimLeft(c.Param("branch"), "/"))
+		commits, err := r.GetLog(branch, feedLimit)
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		items := commitFeedItems(s, c, siteName, userName, repoName, commits)
+		title := fmt.Sprintf("%s/%s commits on %s", userName, repoName, branch)
+		writeFeed(c, format, title, requestURL(c), items)
+	}
+}
+
+func tagsFeedHandler(s *Server, format string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		tags, err := r.GetTags()
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		items := tagFeedItems(s, c, siteName, userName, repoName, tags)
+		title := fmt.Sprintf("%s/%s tags", userName, repoName)
+		writeFeed(c, format, title, requestURL(c), items)
+	}
+}
+
+func userFeed(s *Server, c *gin.Context, siteName, userName string, user *UserRegistry) {
+	items := userFeedItems(s, c, siteName, userName, user)
+	title := fmt.Sprintf("%s activity", userName)
+	writeFeed(c, c.Query("format"), title, requestURL(c), items)
+}
+
+func siteFeed(s *Server, c *gin.Context, siteName string, site *Site) {
+	items := make([]*feedItem, 0)
+	for userName, user := range site.UserRegistries {
+		items = append(items, userFeedItems(s, c, siteName, userName, user)...)
+	}
+	title := fmt.Sprintf("%s activity", siteName)
+	writeFeed(c, c.Query("format"), title, requestURL(c), items)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func newFeedTestServer(t *testing.T) (*Server, []string) {
+	s := newTestServer()
+	mr := newMemoryRepo(t)
+	c1 := mr.commit("first\n\nbody", map[string]string{"a.txt": "1"})
+	c2 := mr.commit("second", map[string]string{"a.txt": "2"})
+	mr.setRef("refs/heads/feature/x", c1)
+	mr.setRef("refs/tags/v1", c1)
+	_, err := mr.repository.CreateTag("v2", c2, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Tagger", Email: "tagger@example.com", When: mr.now.Add(time.Hour)},
+		Message: "release v2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddRepo("s", "u", "r", mr.open(), nil)
+	blobOnly := true
+	static := true
+	for name, settings := range map[string]*RepoSettings{
+		"hidden":    {Hidden: true},
+		"blob-only": {BlobOnly: &blobOnly},
+		"static":    {Static: &static},
+	} {
+		other := newMemoryRepo(t)
+		other.commit(name, map[string]string{"a.txt": name})
+		s.AddRepo("s", "u", name, other.open(), settings)
+	}
+	return s, []string{c1.String(), c2.String()}
+}
+
+func getAtomFeed(t *testing.T, s *Server, path string) *atomFeed {
+	w := get(t, s.Router(), path, nil)
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("GET %s = %d %q %s", path, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	var feed atomFeed
+	err := xml.Unmarshal(w.Body.Bytes(), &feed)
+	if err != nil {
+		t.Fatalf("GET %s: invalid XML: %v", path, err)
+	}
+	return &feed
+}
+
+func TestCommitsFeed(t *testing.T) {
+	s, commits := newFeedTestServer(t)
+	feed := getAtomFeed(t, s, "/s/u/r/feed/commits/master.atom")
+	if feed.Title != "u/r commits on master" || feed.ID != "http://example.com/s/u/r/feed/commits/master.atom" {
+		t.Errorf("feed = %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("feed has %d entries, want 2", len(feed.Entries))
+	}
+	// newer commits first
+	entry := feed.Entries[0]
+	link := "http://example.com/s/u/r/commit/" + commits[1]
+	if entry.ID != link || entry.Link.Href != link || entry.Title != "u/r: second" || entry.Updated != "2020-01-01T00:02:00Z" {
+		t.Errorf("entries[0] = %+v", entry)
+	}
+	if entry.Author == nil || entry.Author.Name != "Test" || entry.Author.Email != "test@example.com" {
+		t.Errorf("entries[0].Author = %+v", entry.Author)
+	}
+	if entry := feed.Entries[1]; entry.Title != "u/r: first" || entry.Content.Body != "first\n\nbody" {
+		t.Errorf("entries[1] = %+v", entry)
+	}
+
+	// branch names may contain slashes
+	feed = getAtomFeed(t, s, "/s/u/r/feed/commits/feature/x.atom")
+	if len(feed.Entries) != 1 || feed.Entries[0].Title != "u/r: first" {
+		t.Errorf("feed of feature/x = %+v", feed)
+	}
+
+	w := get(t, s.Router(), "/s/u/r/feed/commits/master.rss", nil)
+	var rss rssFeed
+	err := xml.Unmarshal(w.Body.Bytes(), &rss)
+	if w.Code != 200 || err != nil || len(rss.Channel.Items) != 2 {
+		t.Fatalf("GET rss = %d %v %s", w.Code, err, w.Body.String())
+	}
+	item := rss.Channel.Items[0]
+	if rss.Version != "2.0" || item.Link != link || item.GUID.Body != link || item.GUID.IsPermaLink ||
+		item.Author != "test@example.com (Test)" || item.PubDate != "Wed, 01 Jan 2020 00:02:00 +0000" {
+		t.Errorf("items[0] = %+v", item)
+	}
+
+	for _, path := range []string{"/s/u/r/feed/commits/master", "/s/u/r/feed/commits/master.json", "/s/u/r/feed/commits/missing.atom"} {
+		if w := get(t, s.Router(), path, nil); w.Code != 404 {
+			t.Errorf("GET %s = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestTagsFeed(t *testing.T) {
+	s, commits := newFeedTestServer(t)
+	feed := getAtomFeed(t, s, "/s/u/r/feed/tags.atom")
+	if feed.Title != "u/r tags" || len(feed.Entries) != 2 {
+		t.Fatalf("feed = %+v", feed)
+	}
+	// annotated tags are dated by taggers
+	entry := feed.Entries[0]
+	if entry.Title != "u/r: v2" || entry.ID != "http://example.com/s/u/r/tags/v2/"+commits[1] ||
+		entry.Link.Href != "http://example.com/s/u/r/tree/v2/" || entry.Updated != "2020-01-01T01:02:00Z" ||
+		entry.Author.Name != "Tagger" || entry.Content.Body != "release v2\n" {
+		t.Errorf("entries[0] = %+v", entry)
+	}
+	if entry := feed.Entries[1]; entry.Title != "u/r: v1" || entry.Author.Name != "Test" || entry.Content.Body != "first\n\nbody" {
+		t.Errorf("entries[1] = %+v", entry)
+	}
+}
+
+func TestAggregatedFeeds(t *testing.T) {
+	s, _ := newFeedTestServer(t)
+	mr := newMemoryRepo(t)
+	mr.commit("other", map[string]string{"a.txt": "a"})
+	s.AddRepo("s", "v", "other", mr.open(), nil)
+
+	tests := []struct {
+		path  string
+		title string
+		want  []string
+	}{
+		// hidden, blob-only and static repos are not aggregated
+		{"/s/u/?format=atom", "u activity", []string{"u/r: first", "u/r: second", "u/r: v1", "u/r: v2"}},
+		{"/s/?format=atom", "s activity", []string{"u/r: first", "u/r: second", "u/r: v1", "u/r: v2", "v/other: other"}},
+	}
+	for _, tt := range tests {
+		feed := getAtomFeed(t, s, tt.path)
+		titles := make([]string, 0, len(feed.Entries))
+		for _, entry := range feed.Entries {
+			titles = append(titles, entry.Title)
+		}
+		sort.Strings(titles)
+		if feed.Title != tt.title || !reflect.DeepEqual(titles, tt.want) {
+			t.Errorf("GET %s = %q %v, want %q %v", tt.path, feed.Title, titles, tt.title, tt.want)
+		}
+	}
+}
@@ -0,0 +1,708 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/graphql"
+	"github.com/taskie/gitan/repo"
+)
+
+const (
+	defaultGraphQLMaxDepth      = 12
+	defaultGraphQLMaxComplexity = 2000
+	// graphQLListSize is the estimated length of lists without the first argument
+	graphQLListSize = 10
+	// graphQLMaxFirst is the largest first argument; larger ones are clamped to it
+	graphQLMaxFirst = 1000
+	// graphQLDiffSize is the default number of files of diffs, each of which has a patch computed
+	graphQLDiffSize = 100
+	// graphQLMaxTextSize is the largest blob returned by the text field
+	graphQLMaxTextSize = 1 << 20
+)
+
+type GraphQLConfig struct {
+	// MaxDepth limits the nesting of fields of a query
+	MaxDepth int `json:"max_depth" toml:"max_depth"`
+	// MaxComplexity limits the estimated cost of a query; each field costs 1 and lists multiply the costs of their elements
+	MaxComplexity int `json:"max_complexity" toml:"max_complexity"`
+}
+
+type gqlSite struct {
+	name string
+	site *Site
+}
+
+type gqlUser struct {
+	siteName string
+	name     string
+	user     *UserRegistry
+}
+
+type gqlRepo struct {
+	siteName string
+	userName string
+	name     string
+	r        *repo.Repo
+	settings *RepoSettings
+}
+
+type gqlCommit struct {
+	repo   *gqlRepo
+	commit *repo.Commit
+}
+
+type gqlRef struct {
+	repo *gqlRepo
+	name string
+	// shortName is the name without refs/heads/ or refs/tags/
+	shortName string
+	commit    *repo.Commit
+	tagger    *repo.Signature
+	message   string
+}
+
+type gqlTreeEntry struct {
+	repo     *gqlRepo
+	commitID string
+	path     string
+	entry    *repo.TreeEntry
+}
+
+type gqlBlob struct {
+	id     string
+	opener repo.FileOpener
+	stat   *repo.FileStat
+}
+
+func (s *Server) graphQLUser(siteName, userName string) *gqlUser {
+	site := s.Sites[siteName]
+	if site == nil {
+		return nil
+	}
+	user := site.UserRegistries[userName]
+	if user == nil {
+		return nil
+	}
+	return &gqlUser{siteName: siteName, name: userName, user: user}
+}
+
+// graphQLRepo returns the repo unless it is missing or blob-only
+func (s *Server) graphQLRepo(user *gqlUser, repoName string) *gqlRepo {
+	r := user.user.Repos[repoName]
+	settings := user.user.RepoSettings(repoName)
+	if r == nil || s.isBlobOnly(settings) {
+		return nil
+	}
+	return &gqlRepo{siteName: user.siteName, userName: user.name, name: repoName, r: r, settings: settings}
+}
+
+// clampFirst limits the first argument to the range of 1 to graphQLMaxFirst
+func clampFirst(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > graphQLMaxFirst {
+		return graphQLMaxFirst
+	}
+	return n
+}
+
+// firstArg returns the clamped first argument, which must be positive
+func firstArg(args graphql.Args) (int, error) {
+	n := args.Int("first")
+	if n < 1 {
+		return 0, fmt.Errorf("first must be positive: %d", n)
+	}
+	return clampFirst(n), nil
+}
+
+// listComplexity multiplies the cost of elements by the clamped first argument (or defaultSize without it)
+func listComplexity(defaultSize int) func(args graphql.Args, child int) int {
+	return func(args graphql.Args, child int) int {
+		n := defaultSize
+		if _, ok := args["first"]; ok {
+			n = clampFirst(args.Int("first"))
+		}
+		// saturate instead of overflowing
+		if child > (math.MaxInt32-1)/n {
+			return math.MaxInt32
+		}
+		return 1 + n*child
+	}
+}
+
+func (gr *gqlRepo) commit(rev string) (*gqlCommit, error) {
+	commits, err := gr.r.GetLog(rev, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &gqlCommit{repo: gr, commit: commits[0]}, nil
+}
+
+func (gr *gqlRepo) log(rev string, args graphql.Args) ([]*gqlCommit, error) {
+	first, err := firstArg(args)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := gr.r.GetLog(rev, first)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*gqlCommit, 0, len(commits))
+	for _, commit := range commits {
+		results = append(results, &gqlCommit{repo: gr, commit: commit})
+	}
+	return results, nil
+}
+
+func (gr *gqlRepo) tree(s *Server, commitID string, args graphql.Args) ([]*gqlTreeEntry, error) {
+	dir := strings.Trim(args.String("path"), "/")
+	first, err := firstArg(args)
+	if err != nil {
+		return nil, err
+	}
+	var tes []*repo.TreeEntry
+	if args.Bool("recursive") {
+		tes, err = gr.r.FindWithOptions(dir, commitID, &repo.FindOptions{
+			MaxDepth: s.treeMaxDepth(gr.settings),
+			Patterns: args.Strings("patterns"),
+			Limit:    first,
+		})
+	} else {
+		tes, err = gr.r.GetTree(dir, commitID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(tes) > first {
+		tes = tes[:first]
+	}
+	results := make([]*gqlTreeEntry, 0, len(tes))
+	for _, te := range tes {
+		path := te.Name
+		if dir != "" {
+			path = dir + "/" + te.Name
+		}
+		results = append(results, &gqlTreeEntry{repo: gr, commitID: commitID, path: path, entry: te})
+	}
+	return results, nil
+}
+
+func (gr *gqlRepo) blob(path string, rev string) (*gqlBlob, error) {
+	opener, stat, err := gr.r.GetFileOpener(strings.Trim(path, "/"), rev)
+	if err != nil {
+		return nil, err
+	}
+	return &gqlBlob{id: stat.ID, opener: opener, stat: stat}, nil
+}
+
+// readme returns the first README file in the directory or nil
+func (gr *gqlRepo) readme(dir string, rev string) (*gqlBlob, error) {
+	dir = strings.Trim(dir, "/")
+	tes, err := gr.r.GetTree(dir, rev)
+	if err != nil {
+		return nil, err
+	}
+	for _, te := range tes {
+		if te.Kind.IsFile() && strings.HasPrefix(strings.ToLower(te.Name), "readme") {
+			path := te.Name
+			if dir != "" {
+				path = dir + "/" + te.Name
+			}
+			return gr.blob(path, rev)
+		}
+	}
+	return nil, nil
+}
+
+func (gr *gqlRepo) rev(args graphql.Args) string {
+	if rev := args.String("rev"); rev != "" {
+		return rev
+	}
+	return gr.settings.defaultRev()
+}
+
+func newGraphQLSchema(s *Server, conf *GraphQLConfig) *graphql.Schema {
+	schema := &graphql.Schema{
+		MaxDepth:      defaultGraphQLMaxDepth,
+		MaxComplexity: defaultGraphQLMaxComplexity,
+	}
+	if conf != nil {
+		if conf.MaxDepth > 0 {
+			schema.MaxDepth = conf.MaxDepth
+		}
+		if conf.MaxComplexity > 0 {
+			schema.MaxComplexity = conf.MaxComplexity
+		}
+	}
+	query := &graphql.Object{Name: "Query"}
+	siteType := &graphql.Object{Name: "Site"}
+	userType := &graphql.Object{Name: "UserRegistry"}
+	repoType := &graphql.Object{Name: "Repo"}
+	refType := &graphql.Object{Name: "Ref"}
+	commitType := &graphql.Object{Name: "Commit"}
+	signatureType := &graphql.Object{Name: "Signature"}
+	treeEntryType := &graphql.Object{Name: "TreeEntry"}
+	blobType := &graphql.Object{Name: "Blob"}
+	fileDiffType := &graphql.Object{Name: "FileDiff"}
+
+	str := func(resolve func(p *graphql.ResolveParams) string) *graphql.FieldDef {
+		return &graphql.FieldDef{
+			Type: graphql.String,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return resolve(p), nil
+			},
+		}
+	}
+	treeArgs := map[string]*graphql.Argument{
+		"path":      {Type: graphql.String},
+		"recursive": {Type: graphql.Boolean},
+		"patterns":  {Type: graphql.NewList(graphql.String)},
+		"first":     {Type: graphql.Int, Default: 100},
+	}
+	revArgs := func(args map[string]*graphql.Argument) map[string]*graphql.Argument {
+		results := map[string]*graphql.Argument{"rev": {Type: graphql.String}}
+		for name, arg := range args {
+			results[name] = arg
+		}
+		return results
+	}
+	// diffField returns changes of at most first files between the revisions returned by revs
+	diffField := func(args map[string]*graphql.Argument, revs func(p *graphql.ResolveParams) (*gqlRepo, string, string)) *graphql.FieldDef {
+		args["first"] = &graphql.Argument{Type: graphql.Int, Default: graphQLDiffSize}
+		return &graphql.FieldDef{
+			Type:       graphql.NewList(fileDiffType),
+			Args:       args,
+			Complexity: listComplexity(graphQLDiffSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				first, err := firstArg(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				gr, from, to := revs(p)
+				return gr.r.GetDiff(from, to, first)
+			},
+		}
+	}
+
+	query.Fields = map[string]*graphql.FieldDef{
+		"sites": {
+			Type:       graphql.NewList(siteType),
+			Complexity: listComplexity(graphQLListSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				names := make([]string, 0, len(s.Sites))
+				for name := range s.Sites {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				sites := make([]*gqlSite, 0, len(names))
+				for _, name := range names {
+					sites = append(sites, &gqlSite{name: name, site: s.Sites[name]})
+				}
+				return sites, nil
+			},
+		},
+		"site": {
+			Type: siteType,
+			Args: map[string]*graphql.Argument{"name": {Type: graphql.String}},
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				site := s.Sites[p.Args.String("name")]
+				if site == nil {
+					return nil, nil
+				}
+				return &gqlSite{name: p.Args.String("name"), site: site}, nil
+			},
+		},
+		"repo": {
+			Type: repoType,
+			Args: map[string]*graphql.Argument{
+				"site": {Type: graphql.String},
+				"user": {Type: graphql.String},
+				"name": {Type: graphql.String},
+			},
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				user := s.graphQLUser(p.Args.String("site"), p.Args.String("user"))
+				if user == nil {
+					return nil, nil
+				}
+				return s.graphQLRepo(user, p.Args.String("name")), nil
+			},
+		},
+	}
+
+	siteType.Fields = map[string]*graphql.FieldDef{
+		"name": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlSite).name }),
+		"users": {
+			Type:       graphql.NewList(userType),
+			Complexity: listComplexity(graphQLListSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				site := p.Source.(*gqlSite)
+				names := make([]string, 0, len(site.site.UserRegistries))
+				for name := range site.site.UserRegistries {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				users := make([]*gqlUser, 0, len(names))
+				for _, name := range names {
+					users = append(users, &gqlUser{siteName: site.name, name: name, user: site.site.UserRegistries[name]})
+				}
+				return users, nil
+			},
+		},
+		"user": {
+			Type: userType,
+			Args: map[string]*graphql.Argument{"name": {Type: graphql.String}},
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return s.graphQLUser(p.Source.(*gqlSite).name, p.Args.String("name")), nil
+			},
+		},
+	}
+
+	userType.Fields = map[string]*graphql.FieldDef{
+		"name": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlUser).name }),
+		"repos": {
+			Type:       graphql.NewList(repoType),
+			Complexity: listComplexity(graphQLListSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				user := p.Source.(*gqlUser)
+				names := make([]string, 0, len(user.user.Repos))
+				for name := range user.user.Repos {
+					if !user.user.RepoSettings(name).Hidden {
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+				repos := make([]*gqlRepo, 0, len(names))
+				for _, name := range names {
+					if gr := s.graphQLRepo(user, name); gr != nil {
+						repos = append(repos, gr)
+					}
+				}
+				return repos, nil
+			},
+		},
+		"repo": {
+			Type: repoType,
+			Args: map[string]*graphql.Argument{"name": {Type: graphql.String}},
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return s.graphQLRepo(p.Source.(*gqlUser), p.Args.String("name")), nil
+			},
+		},
+	}
+
+	repoType.Fields = map[string]*graphql.FieldDef{
+		"site":        str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRepo).siteName }),
+		"user":        str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRepo).userName }),
+		"name":        str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRepo).name }),
+		"displayName": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRepo).settings.DisplayName }),
+		"description": {
+			Type: graphql.String,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				meta, err := repoMetadata(gr.r, gr.settings)
+				if err != nil {
+					return nil, err
+				}
+				return meta.Description, nil
+			},
+		},
+		"defaultBranch": {
+			Type: graphql.String,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				meta, err := repoMetadata(gr.r, gr.settings)
+				if err != nil {
+					return nil, err
+				}
+				return meta.DefaultBranch, nil
+			},
+		},
+		"branches": {
+			Type:       graphql.NewList(refType),
+			Complexity: listComplexity(graphQLListSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				branches, err := gr.r.GetBranches()
+				if err != nil {
+					return nil, err
+				}
+				refs := make([]*gqlRef, 0, len(branches))
+				for _, branch := range branches {
+					refs = append(refs, &gqlRef{repo: gr, name: branch.Name, shortName: branch.ShortName, commit: branch.Commit})
+				}
+				return refs, nil
+			},
+		},
+		"tags": {
+			Type:       graphql.NewList(refType),
+			Complexity: listComplexity(graphQLListSize),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				tags, err := gr.r.GetTags()
+				if err != nil {
+					return nil, err
+				}
+				refs := make([]*gqlRef, 0, len(tags))
+				for _, tag := range tags {
+					refs = append(refs, &gqlRef{repo: gr, name: tag.Name, shortName: tag.ShortName, commit: tag.Commit, tagger: tag.Tagger, message: tag.Message})
+				}
+				return refs, nil
+			},
+		},
+		"commit": {
+			Type: commitType,
+			Args: revArgs(nil),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				return gr.commit(gr.rev(p.Args))
+			},
+		},
+		"log": {
+			Type:       graphql.NewList(commitType),
+			Args:       revArgs(map[string]*graphql.Argument{"first": {Type: graphql.Int, Default: 20}}),
+			Complexity: listComplexity(20),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				return gr.log(gr.rev(p.Args), p.Args)
+			},
+		},
+		"tree": {
+			Type:       graphql.NewList(treeEntryType),
+			Args:       revArgs(treeArgs),
+			Complexity: listComplexity(100),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				commitID, err := gr.r.GetCommitHash(gr.rev(p.Args))
+				if err != nil {
+					return nil, err
+				}
+				return gr.tree(s, commitID, p.Args)
+			},
+		},
+		"blob": {
+			Type: blobType,
+			Args: revArgs(map[string]*graphql.Argument{"path": {Type: graphql.String}}),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				return gr.blob(p.Args.String("path"), gr.rev(p.Args))
+			},
+		},
+		"readme": {
+			Type: blobType,
+			Args: revArgs(map[string]*graphql.Argument{"path": {Type: graphql.String}}),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				gr := p.Source.(*gqlRepo)
+				return gr.readme(p.Args.String("path"), gr.rev(p.Args))
+			},
+		},
+		"diff": diffField(revArgs(map[string]*graphql.Argument{"from": {Type: graphql.String}}), func(p *graphql.ResolveParams) (*gqlRepo, string, string) {
+			gr := p.Source.(*gqlRepo)
+			return gr, p.Args.String("from"), gr.rev(p.Args)
+		}),
+	}
+
+	refType.Fields = map[string]*graphql.FieldDef{
+		"name":      str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRef).name }),
+		"shortName": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRef).shortName }),
+		"message":   str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlRef).message }),
+		"tagger": {
+			Type: signatureType,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*gqlRef).tagger, nil
+			},
+		},
+		"commit": {
+			Type: commitType,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				ref := p.Source.(*gqlRef)
+				return &gqlCommit{repo: ref.repo, commit: ref.commit}, nil
+			},
+		},
+	}
+
+	commitType.Fields = map[string]*graphql.FieldDef{
+		"id":      str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlCommit).commit.ID }),
+		"message": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlCommit).commit.Message }),
+		"title":   str(func(p *graphql.ResolveParams) string { return commitTitle(p.Source.(*gqlCommit).commit.Message) }),
+		"author": {
+			Type: signatureType,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*gqlCommit).commit.Author, nil
+			},
+		},
+		"committer": {
+			Type: signatureType,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*gqlCommit).commit.Committer, nil
+			},
+		},
+		"parents": {
+			Type:       graphql.NewList(commitType),
+			Complexity: listComplexity(2),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				ci := p.Source.(*gqlCommit)
+				parents := make([]*gqlCommit, 0, len(ci.commit.ParentHashes))
+				for _, hash := range ci.commit.ParentHashes {
+					parent, err := ci.repo.commit(hash)
+					if err != nil {
+						return nil, err
+					}
+					parents = append(parents, parent)
+				}
+				return parents, nil
+			},
+		},
+		"history": {
+			Type:       graphql.NewList(commitType),
+			Args:       map[string]*graphql.Argument{"first": {Type: graphql.Int, Default: 20}},
+			Complexity: listComplexity(20),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				ci := p.Source.(*gqlCommit)
+				return ci.repo.log(ci.commit.ID, p.Args)
+			},
+		},
+		"tree": {
+			Type:       graphql.NewList(treeEntryType),
+			Args:       treeArgs,
+			Complexity: listComplexity(100),
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				ci := p.Source.(*gqlCommit)
+				return ci.repo.tree(s, ci.commit.ID, p.Args)
+			},
+		},
+		"blob": {
+			Type: blobType,
+			Args: map[string]*graphql.Argument{"path": {Type: graphql.String}},
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				ci := p.Source.(*gqlCommit)
+				return ci.repo.blob(p.Args.String("path"), ci.commit.ID)
+			},
+		},
+		"diff": diffField(map[string]*graphql.Argument{"from": {Type: graphql.String}}, func(p *graphql.ResolveParams) (*gqlRepo, string, string) {
+			ci := p.Source.(*gqlCommit)
+			return ci.repo, p.Args.String("from"), ci.commit.ID
+		}),
+	}
+
+	signatureType.Fields = map[string]*graphql.FieldDef{
+		"name":  str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.Signature).Name }),
+		"email": str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.Signature).Email }),
+		"date":  str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.Signature).When.Format(time.RFC3339) }),
+	}
+
+	treeEntryType.Fields = map[string]*graphql.FieldDef{
+		"id":   str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlTreeEntry).entry.Hash }),
+		"name": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlTreeEntry).entry.Name }),
+		"path": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlTreeEntry).path }),
+		"mode": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlTreeEntry).entry.ModeOctal }),
+		"kind": str(func(p *graphql.ResolveParams) string { return string(p.Source.(*gqlTreeEntry).entry.Kind) }),
+		"blob": {
+			Type: blobType,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				te := p.Source.(*gqlTreeEntry)
+				if !te.entry.Kind.IsFile() && te.entry.Kind != repo.KindSymlink {
+					return nil, nil
+				}
+				return te.repo.blob(te.path, te.commitID)
+			},
+		},
+	}
+
+	blobType.Fields = map[string]*graphql.FieldDef{
+		"id":   str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlBlob).id }),
+		"name": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlBlob).stat.Name }),
+		"size": {
+			Type: graphql.Int,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*gqlBlob).stat.Size, nil
+			},
+		},
+		"isBinary": {
+			Type: graphql.Boolean,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*gqlBlob).stat.IsBinary, nil
+			},
+		},
+		"lfsOid": str(func(p *graphql.ResolveParams) string { return p.Source.(*gqlBlob).stat.LFSOID }),
+		"text": {
+			Type: graphql.String,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				blob := p.Source.(*gqlBlob)
+				if blob.stat.IsBinary {
+					return nil, nil
+				}
+				bs, err := readOpener(blob.opener, graphQLMaxTextSize)
+				if err != nil {
+					return nil, err
+				}
+				return string(bs), nil
+			},
+		},
+	}
+
+	fileDiffType.Fields = map[string]*graphql.FieldDef{
+		"action":   str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).Action }),
+		"fromPath": str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).FromPath }),
+		"fromId":   str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).FromHash }),
+		"toPath":   str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).ToPath }),
+		"toId":     str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).ToHash }),
+		"patch":    str(func(p *graphql.ResolveParams) string { return p.Source.(*repo.FileDiff).Patch }),
+		"isBinary": {
+			Type: graphql.Boolean,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*repo.FileDiff).IsBinary, nil
+			},
+		},
+		"additions": {
+			Type: graphql.Int,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*repo.FileDiff).Additions, nil
+			},
+		},
+		"deletions": {
+			Type: graphql.Int,
+			Resolve: func(p *graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*repo.FileDiff).Deletions, nil
+			},
+		},
+	}
+
+	schema.Query = query
+	return schema
+}
+
+// graphQLHandler executes a query given by the JSON body of POST or the query, operationName and variables parameters of GET
+func graphQLHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var req graphql.Request
+		if c.Request.Method == "GET" {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if variables := c.Query("variables"); variables != "" {
+				err := json.Unmarshal([]byte(variables), &req.Variables)
+				if err != nil {
+					c.JSON(400, &graphql.Response{Errors: []*graphql.Error{{Message: err.Error()}}})
+					return
+				}
+			}
+		} else {
+			err := c.ShouldBindJSON(&req)
+			if err != nil {
+				c.JSON(400, &graphql.Response{Errors: []*graphql.Error{{Message: err.Error()}}})
+				return
+			}
+		}
+		res := s.GraphQL.Execute(c.Request.Context(), &req)
+		if res.Data == nil {
+			c.JSON(400, res)
+		} else {
+			c.JSON(200, res)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/taskie/gitan/graphql"
+)
+
+func graphQLRequest(t *testing.T, s *Server, query string) (int, *graphql.Response) {
+	body, err := json.Marshal(&graphql.Request{Query: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res graphql.Response
+	w := request(t, s.Router(), "POST", "/graphql", string(body), &res)
+	return w.Code, &res
+}
+
+func TestGraphQLFirst(t *testing.T) {
+	s := newTestServer()
+	mr := newMemoryRepo(t)
+	for i := 0; i < 5; i++ {
+		mr.commit(fmt.Sprintf("c%d", i), map[string]string{fmt.Sprintf("%d.txt", i): "x"})
+	}
+	s.AddRepo("s", "u", "r", mr.open(), nil)
+
+	t.Run("limits", func(t *testing.T) {
+		code, res := graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") {
+			log(first: 2) { id history(first: 3) { id } }
+			tree(first: 4) { name }
+		} }`)
+		if code != 200 || len(res.Errors) != 0 {
+			t.Fatalf("%d %+v", code, res.Errors)
+		}
+		bs, _ := json.Marshal(res.Data)
+		var data struct {
+			Repo struct {
+				Log []struct {
+					History []struct{} `json:"history"`
+				} `json:"log"`
+				Tree []struct{} `json:"tree"`
+			} `json:"repo"`
+		}
+		err := json.Unmarshal(bs, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data.Repo.Log) != 2 || len(data.Repo.Log[0].History) != 3 || len(data.Repo.Tree) != 4 {
+			t.Errorf("unexpected lengths: %s", bs)
+		}
+	})
+
+	for _, field := range []string{
+		"log(first: 0) { id }",
+		"log(first: -1) { id }",
+		"tree(first: 0) { name }",
+		"tree(recursive: true, first: -1) { name }",
+		"commit { history(first: 0) { id } }",
+	} {
+		t.Run(field, func(t *testing.T) {
+			_, res := graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { `+field+` } }`)
+			if len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "first must be positive") {
+				t.Errorf("errors = %+v, want the first argument refused", res.Errors)
+			}
+		})
+	}
+
+	t.Run("complexity of clamped first", func(t *testing.T) {
+		// 1000 commits of 1 + 1 fields fit in the default limit of 2000 only if first is clamped
+		code, res := graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { log(first: 1000000) { id } } }`)
+		if code != 200 || len(res.Errors) != 0 {
+			t.Errorf("%d %+v, want success", code, res.Errors)
+		}
+		code, res = graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { log(first: 1000000) { id history { id } } } }`)
+		if code != 400 || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "complexity") {
+			t.Errorf("%d %+v, want the complexity limit exceeded", code, res.Errors)
+		}
+	})
+
+	// costs of deeply nested lists must not wrap around under the limit
+	for depth := 1; depth <= 8; depth++ {
+		query := "id"
+		for i := 0; i < depth; i++ {
+			query = "history(first: 1000) { " + query + " }"
+		}
+		query = `{ repo(site: "s", user: "u", name: "r") { log(first: 1000) { ` + query + ` } } }`
+		code, res := graphQLRequest(t, s, query)
+		if code != 400 || len(res.Errors) != 1 || res.Errors[0].Message != "query complexity exceeds the limit 2000" {
+			t.Errorf("%d levels of history: %d %+v, want the complexity limit exceeded", depth, code, res.Errors)
+		}
+	}
+}
+
+func TestGraphQLDiff(t *testing.T) {
+	s := newTestServer()
+	mr := newMemoryRepo(t)
+	mr.commit("c1", map[string]string{"a.txt": "a"})
+	mr.commit("c2", map[string]string{"a.txt": "b", "b.txt": "b", "c.txt": "c"})
+	s.AddRepo("s", "u", "r", mr.open(), nil)
+	var data struct {
+		Repo struct {
+			All   []struct{ ToPath string } `json:"all"`
+			First []struct{ ToPath string } `json:"first"`
+		} `json:"repo"`
+	}
+	code, res := graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { all: diff { toPath } first: diff(first: 2) { toPath } } }`)
+	if code != 200 || len(res.Errors) != 0 {
+		t.Fatalf("%d %+v", code, res.Errors)
+	}
+	bs, _ := json.Marshal(res.Data)
+	err := json.Unmarshal(bs, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Repo.All) != 3 || len(data.Repo.First) != 2 {
+		t.Errorf("unexpected diffs: %s", bs)
+	}
+	_, res = graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { diff(first: 0) { toPath } } }`)
+	if len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "first must be positive") {
+		t.Errorf("errors = %+v, want the first argument refused", res.Errors)
+	}
+	// each file costs by its fields
+	_, res = graphQLRequest(t, s, `{ repo(site: "s", user: "u", name: "r") { diff(first: 1000) { toPath patch } } }`)
+	if len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "complexity") {
+		t.Errorf("errors = %+v, want the complexity limit exceeded", res.Errors)
+	}
+}
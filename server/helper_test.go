@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// memoryRepo builds repos on memory storage by committing files of a worktree
+type memoryRepo struct {
+	t          *testing.T
+	repository *git.Repository
+	worktree   *git.Worktree
+	now        time.Time
+}
+
+func newMemoryRepo(t *testing.T) *memoryRepo {
+	fs := memfs.New()
+	repository, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memoryRepo{t: t, repository: repository, worktree: worktree, now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// commit writes files to the worktree and commits them to the current branch
+func (mr *memoryRepo) commit(message string, files map[string]string) plumbing.Hash {
+	for path, contents := range files {
+		f, err := mr.worktree.Filesystem.Create(path)
+		if err == nil {
+			_, err = f.Write([]byte(contents))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			_, err = mr.worktree.Add(path)
+		}
+		if err != nil {
+			mr.t.Fatal(err)
+		}
+	}
+	mr.now = mr.now.Add(time.Minute)
+	h, err := mr.worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: mr.now},
+	})
+	if err != nil {
+		mr.t.Fatal(err)
+	}
+	return h
+}
+
+func (mr *memoryRepo) setRef(name string, h plumbing.Hash) {
+	err := mr.repository.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), h))
+	if err != nil {
+		mr.t.Fatal(err)
+	}
+}
+
+func (mr *memoryRepo) open() *repo.Repo {
+	return repo.NewRepoWithRepository(mr.repository)
+}
+
+func newTestServer() *Server {
+	return &Server{Sites: make(map[string]*Site), BathPath: "/"}
+}
+
+// get requests the path and decodes the JSON response into v unless v is nil
+func get(t *testing.T, handler http.Handler, path string, v interface{}) *httptest.ResponseRecorder {
+	return request(t, handler, "GET", path, "", v)
+}
+
+func request(t *testing.T, handler http.Handler, method string, path string, body string, v interface{}) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	handler.ServeHTTP(w, req)
+	if v != nil {
+		err := json.Unmarshal(w.Body.Bytes(), v)
+		if err != nil {
+			t.Fatalf("%s %s: invalid JSON response: %s: %s", method, path, err, w.Body.String())
+		}
+	}
+	return w
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// see https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+type lfsBatchRequest struct {
+	Operation string            `json:"operation"`
+	Transfers []string          `json:"transfers"`
+	Objects   []*lfsBatchObject `json:"objects"`
+}
+
+type lfsBatchObject struct {
+	OID           string                     `json:"oid"`
+	Size          int64                      `json:"size"`
+	Authenticated bool                       `json:"authenticated,omitempty"`
+	Actions       map[string]*lfsBatchAction `json:"actions,omitempty"`
+	Error         *lfsBatchError             `json:"error,omitempty"`
+}
+
+type lfsBatchAction struct {
+	Href string `json:"href"`
+}
+
+type lfsBatchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lfsBatchResponse struct {
+	Transfer string            `json:"transfer"`
+	Objects  []*lfsBatchObject `json:"objects"`
+}
+
+func lfsError(c *gin.Context, code int, message string) {
+	c.Header("Content-Type", lfsMediaType)
+	c.JSON(code, gin.H{"message": message})
+}
+
+func lfsBatchHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			lfsError(c, 404, fmt.Sprintf("no site: %s", siteName))
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			lfsError(c, 404, fmt.Sprintf("no user: %s", userName))
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			lfsError(c, 404, fmt.Sprintf("no repo: %s", repoName))
+			return
+		}
+		var req lfsBatchRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			lfsError(c, 422, err.Error())
+			return
+		}
+		if req.Operation != "download" {
+			lfsError(c, 403, fmt.Sprintf("operation not allowed: %s", req.Operation))
+			return
+		}
+		objects := make([]*lfsBatchObject, 0, len(req.Objects))
+		for _, reqObj := range req.Objects {
+			obj := &lfsBatchObject{
+				OID:  reqObj.OID,
+				Size: reqObj.Size,
+			}
+			size, err := r.StatLFSObject(reqObj.OID)
+			if err != nil {
+				obj.Error = &lfsBatchError{Code: 404, Message: "object does not exist"}
+			} else if size != reqObj.Size {
+				obj.Error = &lfsBatchError{Code: 422, Message: "size mismatch"}
+			} else {
+				obj.Authenticated = true
+				obj.Actions = map[string]*lfsBatchAction{
+					"download": {Href: s.absoluteURL(c, siteName, userName, repoName, "info/lfs/objects", reqObj.OID)},
+				}
+			}
+			objects = append(objects, obj)
+		}
+		c.Header("Content-Type", lfsMediaType)
+		c.JSON(200, &lfsBatchResponse{Transfer: "basic", Objects: objects})
+	}
+}
+
+func lfsObjectHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			lfsError(c, 404, fmt.Sprintf("no site: %s", siteName))
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			lfsError(c, 404, fmt.Sprintf("no user: %s", userName))
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			lfsError(c, 404, fmt.Sprintf("no repo: %s", repoName))
+			return
+		}
+		oid := c.Param("oid")
+		size, err := r.StatLFSObject(oid)
+		if err != nil {
+			lfsError(c, 404, err.Error())
+			return
+		}
+		reader, err := r.OpenLFSObject(oid)
+		if err != nil {
+			lfsError(c, 404, err.Error())
+			return
+		}
+		defer reader.Close()
+		c.DataFromReader(200, size, "application/octet-stream", reader, nil)
+	}
+}
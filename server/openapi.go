@@ -0,0 +1,459 @@
+package server
+
+import (
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/graphql"
+	"github.com/taskie/gitan/index"
+	"github.com/taskie/gitan/repo"
+)
+
+// apiVersion is the version of the API described by /openapi.json
+const apiVersion = "1.0.0"
+
+// envelope is a JSON object of {"ok": true} and the fields
+type envelope map[string]interface{}
+
+// binary is the schema of raw contents
+type binary struct{}
+
+type apiParam struct {
+	name        string
+	in          string
+	description string
+	value       interface{}
+	// catchAll means the path parameter matches the rest of the path including slashes
+	catchAll bool
+}
+
+type apiOperation struct {
+	method  string
+	path    string
+	id      string
+	summary string
+	params  []*apiParam
+	// request is the JSON request body
+	request interface{}
+	// content maps media types of successful responses to their schemas
+	content map[string]interface{}
+}
+
+func pathParam(name string, description string) *apiParam {
+	return &apiParam{name: name, in: "path", description: description, value: ""}
+}
+
+// catchAllParam is a path parameter of a catch-all route (e.g. *path of gin)
+func catchAllParam(name string, description string) *apiParam {
+	return &apiParam{name: name, in: "path", description: description, value: "", catchAll: true}
+}
+
+func queryParam(name string, value interface{}, description string) *apiParam {
+	return &apiParam{name: name, in: "query", description: description, value: value}
+}
+
+func jsonContent(v interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": v}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	kindType = reflect.TypeOf(repo.Kind(""))
+)
+
+// schemaPrefixes disambiguate names of schemas of other packages than repo and server
+var schemaPrefixes = map[string]string{
+	"index":   "Index",
+	"graphql": "GraphQL",
+}
+
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return schemaPrefixes[path.Base(t.PkgPath())] + string(name)
+}
+
+// schema returns the JSON schema of v whose named struct types are registered as components
+func (g *schemaGenerator) schema(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case binary:
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	case envelope:
+		properties := map[string]interface{}{"ok": map[string]interface{}{"type": "boolean"}}
+		required := []string{"ok"}
+		for name, field := range v {
+			properties[name] = g.schema(field)
+			required = append(required, name)
+		}
+		sort.Strings(required[1:])
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return g.typeSchema(reflect.TypeOf(v))
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == kindType:
+		return map[string]interface{}{"type": "string", "enum": []repo.Kind{
+			repo.KindFile, repo.KindExecutable, repo.KindSymlink, repo.KindDir, repo.KindSubmodule, repo.KindUnknown,
+		}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// registered before its fields for recursive types
+			g.schemas[name] = nil
+			properties := make(map[string]interface{})
+			required := make([]string, 0)
+			g.addProperties(t, properties, &required)
+			schema := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			g.schemas[name] = schema
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// addProperties adds fields of the struct type as encoding/json does; fields without omitempty are required
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if f.Anonymous && parts[0] == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			g.addProperties(ft, properties, required)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := parts[0]
+		if name == "" {
+			name = f.Name
+		}
+		schema := g.typeSchema(f.Type)
+		switch f.Type.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			schema = nullable(schema)
+		}
+		properties[name] = schema
+		omitEmpty := false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]interface{}{"nullable": true, "allOf": []interface{}{schema}}
+	}
+	results := map[string]interface{}{"nullable": true}
+	for k, v := range schema {
+		results[k] = v
+	}
+	return results
+}
+
+func commitQueryParams() []*apiParam {
+	return []*apiParam{
+		queryParam("q", "", "substring (or regular expression) of commit messages"),
+		queryParam("regexp", false, "treat q as a regular expression"),
+		queryParam("i", false, "ignore case of q"),
+		queryParam("author", "", "substring of author names or emails"),
+		queryParam("committer", "", "substring of committer names or emails"),
+		queryParam("since", "", "RFC 3339 time or date (YYYY-MM-DD)"),
+		queryParam("until", "", "RFC 3339 time or date (YYYY-MM-DD)"),
+		queryParam("max", 0, "maximum number of results"),
+	}
+}
+
+// apiOperations returns operations of the routes registered by Router
+func (s *Server) apiOperations() []*apiOperation {
+	feeds := map[string]interface{}{
+		"application/atom+xml": binary{},
+		"application/rss+xml":  binary{},
+	}
+	siteParam := pathParam("siteName", "name of the site")
+	userParam := pathParam("userName", "name of the user registry")
+	repoParams := []*apiParam{siteParam, userParam, pathParam("repoName", "name of the repo")}
+	withRepo := func(params ...*apiParam) []*apiParam {
+		return append(append([]*apiParam{}, repoParams...), params...)
+	}
+	revParam := pathParam("rev", "branch, tag, commit hash or revision expression")
+	filePathParam := catchAllParam("path", "path in the tree")
+	ops := []*apiOperation{
+		{method: "GET", path: "/", id: "listSites", summary: "List sites",
+			content: jsonContent(envelope{"sites": []*SiteSpec{}})},
+		{method: "GET", path: "/search/commits", id: "searchAllCommits", summary: "Search commits of every listed repo",
+			params: append(commitQueryParams(),
+				queryParam("rev", "", "revision searched in each repo (default: every allowed ref or HEAD)"),
+				queryParam("site", "", "restrict to the site"),
+				queryParam("user", "", "restrict to the user registry"),
+				queryParam("repo", "", "restrict to the repo name")),
+			content: jsonContent(envelope{"commits": []*CommitSearchResult{}})},
+		{method: "GET", path: "/graphql", id: "queryGraphQL", summary: "Execute a GraphQL query",
+			params: []*apiParam{
+				queryParam("query", "", "GraphQL document"),
+				queryParam("operationName", "", "operation to execute"),
+				queryParam("variables", "", "JSON object of variables"),
+			},
+			content: jsonContent(&graphql.Response{})},
+		{method: "POST", path: "/graphql", id: "postGraphQL", summary: "Execute a GraphQL query",
+			request: &graphql.Request{},
+			content: jsonContent(&graphql.Response{})},
+		{method: "GET", path: "/openapi.json", id: "getOpenAPI", summary: "Get this document",
+			content: jsonContent(nil)},
+	}
+	if s.Index != nil {
+		ops = append(ops, &apiOperation{method: "GET", path: "/search", id: "searchCode", summary: "Search indexed files",
+			params: []*apiParam{
+				queryParam("q", "", "literal text to search (at least 3 bytes)"),
+				queryParam("i", false, "ignore case"),
+				queryParam("max", 0, "maximum number of results"),
+				queryParam("site", "", "restrict to the site"),
+				queryParam("user", "", "restrict to the user registry"),
+				queryParam("repo", "", "restrict to the repo name"),
+			},
+			content: jsonContent(envelope{"results": []*index.Result{}})})
+	}
+	ops = append(ops,
+		&apiOperation{method: "GET", path: "/{siteName}/", id: "listUsers", summary: "List user registries of the site",
+			params:  []*apiParam{siteParam, queryParam("format", "", "atom or rss to get the feed of the site")},
+			content: mergeContent(jsonContent(envelope{"users": []*UserSpec{}}), feeds)},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/", id: "listRepos", summary: "List listed repos of the user registry",
+			params: []*apiParam{siteParam, userParam,
+				queryParam("metadata", false, "include metadata of repos"),
+				queryParam("format", "", "atom or rss to get the feed of the user registry")},
+			content: mergeContent(jsonContent(envelope{"repos": []*RepoSpec{}}), feeds)},
+	)
+	return append(ops,
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/{path}", id: "getStaticFile",
+			summary: "Get a file of the published branch of a static repo (served instead of other routes of the repo)",
+			params:  withRepo(filePathParam),
+			content: map[string]interface{}{"*/*": binary{}}},
+		&apiOperation{method: "POST", path: "/{siteName}/{userName}/{repoName}/info/lfs/objects/batch", id: "lfsBatch",
+			summary: "Git LFS batch API (download only; not served for blob-only repos)",
+			params:  withRepo(),
+			request: &lfsBatchRequest{},
+			content: map[string]interface{}{lfsMediaType: &lfsBatchResponse{}}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/info/lfs/objects/{oid}", id: "getLFSObject",
+			summary: "Download a Git LFS object (not served for blob-only repos)",
+			params:  withRepo(pathParam("oid", "SHA-256 of the object")),
+			content: map[string]interface{}{"application/octet-stream": binary{}}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/{rev}/{path}", id: "getRawFile",
+			summary: "Get a file of a blob-only repo",
+			params:  withRepo(revParam, filePathParam, queryParam("follow_symlinks", false, "resolve symlinks")),
+			content: map[string]interface{}{"*/*": binary{}}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}", id: "getRepo", summary: "Get branches and metadata",
+			params:  withRepo(),
+			content: jsonContent(envelope{"branches": []*repo.Revision{}, "metadata": &repo.Metadata{}})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/blob/{rev}/{path}", id: "getFile", summary: "Get a file",
+			params:  withRepo(revParam, filePathParam, queryParam("follow_symlinks", false, "resolve symlinks")),
+			content: map[string]interface{}{"*/*": binary{}}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/tree/{rev}/{path}", id: "getTree",
+			summary: "List entries of a directory",
+			params: withRepo(revParam, filePathParam,
+				queryParam("recursive", false, "list entries of subdirectories"),
+				queryParam("expand", "", "comma-separated optional fields: size, type and last_commit"),
+				queryParam("pattern", []string{}, "globs of paths to include (\"!\" excludes); repeatable"),
+				queryParam("type", "", "comma-separated kinds of entries"),
+				queryParam("min_size", int64(0), "minimum size of blobs"),
+				queryParam("max_size", int64(0), "maximum size of blobs"),
+				queryParam("limit", 0, "maximum number of entries"),
+				queryParam("format", "", "ndjson to stream recursive listings one entry per line")),
+			content: map[string]interface{}{
+				"application/json":     envelope{"entries": []*repo.TreeEntry{}, "submodules": []*repo.Submodule{}},
+				"application/x-ndjson": &repo.TreeEntry{},
+			}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/cat/{hash}", id: "getBlob", summary: "Get a blob by its hash",
+			params:  withRepo(pathParam("hash", "hash of the blob")),
+			content: map[string]interface{}{"text/plain": binary{}}},
+		&apiOperation{method: "POST", path: "/{siteName}/{userName}/{repoName}/batch", id: "batchFiles",
+			summary: "Get many files or blobs at once",
+			params:  withRepo(queryParam("format", "", "multipart to stream contents as multipart/mixed")),
+			request: &BatchRequest{},
+			content: map[string]interface{}{
+				"application/json": envelope{"objects": []*BatchResult{}},
+				"multipart/mixed":  binary{},
+			}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/commit/{rev}", id: "getCommit",
+			summary: "Get a commit with its files",
+			params:  withRepo(revParam),
+			content: jsonContent(&repo.Commit{})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/resolve/{rev}", id: "resolveRevision",
+			summary: "Resolve a revision",
+			params:  withRepo(catchAllParam("rev", "revision")),
+			content: jsonContent(envelope{"revision": &repo.ResolvedRevision{}})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/log/{rev}", id: "getLog", summary: "List commits reachable from a revision",
+			params: withRepo(revParam,
+				queryParam("max", 0, "maximum number of commits"),
+				queryParam("pickaxe", "", "list commits changing the number of occurrences of the string (or lines matching the regexp)"),
+				queryParam("regexp", false, "treat pickaxe as a regular expression"),
+				queryParam("path", []string{}, "globs of paths for pickaxe; repeatable")),
+			content: jsonContent(envelope{"commits": []*repo.Commit{}})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/grep/{rev}", id: "grep", summary: "Search lines of files",
+			params: withRepo(revParam,
+				queryParam("q", "", "regular expression"),
+				queryParam("path", []string{}, "globs of paths; repeatable"),
+				queryParam("i", false, "ignore case"),
+				queryParam("max", 0, "maximum number of matches")),
+			content: jsonContent(envelope{"matches": []*repo.GrepMatch{}})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/search/commits", id: "searchCommits", summary: "Search commits",
+			params:  withRepo(append(commitQueryParams(), queryParam("rev", "", "revision to search (default: every allowed ref or HEAD)"))...),
+			content: jsonContent(envelope{"commits": []*repo.Commit{}})},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/feed/commits/{branch}", id: "getCommitsFeed",
+			summary: "Get the feed of commits",
+			params:  withRepo(catchAllParam("branch", "branch name followed by .atom or .rss")),
+			content: feeds},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/feed/tags.atom", id: "getTagsAtom", summary: "Get the Atom feed of tags",
+			params:  withRepo(),
+			content: map[string]interface{}{"application/atom+xml": binary{}}},
+		&apiOperation{method: "GET", path: "/{siteName}/{userName}/{repoName}/feed/tags.rss", id: "getTagsRSS", summary: "Get the RSS feed of tags",
+			params:  withRepo(),
+			content: map[string]interface{}{"application/rss+xml": binary{}}},
+	)
+}
+
+func mergeContent(contents ...map[string]interface{}) map[string]interface{} {
+	results := make(map[string]interface{})
+	for _, content := range contents {
+		for mediaType, v := range content {
+			results[mediaType] = v
+		}
+	}
+	return results
+}
+
+// OpenAPIDocument returns the OpenAPI 3 document of the routes registered by Router
+func (s *Server) OpenAPIDocument() map[string]interface{} {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+	errorResponse := map[string]interface{}{
+		"description": "error",
+		"content": jsonContent(map[string]interface{}{
+			"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+		}),
+	}
+	paths := make(map[string]interface{})
+	for _, op := range s.apiOperations() {
+		params := make([]interface{}, 0, len(op.params))
+		for _, p := range op.params {
+			param := map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"schema":      g.schema(p.value),
+			}
+			if p.in == "path" {
+				param["required"] = true
+			}
+			if p.catchAll {
+				// OpenAPI has no notion of path parameters containing slashes
+				param["description"] = p.description + "; the rest of the path which may contain unescaped slashes"
+				param["x-catch-all"] = true
+			}
+			params = append(params, param)
+		}
+		content := make(map[string]interface{})
+		for mediaType, v := range op.content {
+			content[mediaType] = map[string]interface{}{"schema": g.schema(v)}
+		}
+		operation := map[string]interface{}{
+			"operationId": op.id,
+			"summary":     op.summary,
+			"parameters":  params,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{"description": "success", "content": content},
+				"400": errorResponse,
+				"404": errorResponse,
+			},
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(map[string]interface{}{"schema": g.schema(op.request)}),
+			}
+		}
+		item, _ := paths[op.path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+	g.schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"ok":    map[string]interface{}{"type": "boolean"},
+			"error": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"ok", "error"},
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "gitan",
+			"version": apiVersion,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.schemas},
+	}
+	// paths start with "/", so the server URL has no trailing slash
+	if basePath := strings.TrimSuffix(s.BathPath, "/"); basePath != "" {
+		doc["servers"] = []interface{}{map[string]interface{}{"url": basePath}}
+	}
+	return doc
+}
+
+func openAPIHandler(s *Server) func(c *gin.Context) {
+	doc := s.OpenAPIDocument()
+	return func(c *gin.Context) {
+		c.JSON(200, doc)
+	}
+}
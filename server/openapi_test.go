@@ -0,0 +1,74 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIPathParams(t *testing.T) {
+	s := newTestServer()
+	doc := s.OpenAPIDocument()
+	templateParam := regexp.MustCompile(`\{([^}]+)\}`)
+	for path, item := range doc["paths"].(map[string]interface{}) {
+		names := make(map[string]bool)
+		for _, m := range templateParam.FindAllStringSubmatch(path, -1) {
+			names[m[1]] = true
+		}
+		for method, op := range item.(map[string]interface{}) {
+			declared := make(map[string]bool)
+			for _, v := range op.(map[string]interface{})["parameters"].([]interface{}) {
+				param := v.(map[string]interface{})
+				if param["in"] != "path" {
+					continue
+				}
+				name := param["name"].(string)
+				declared[name] = true
+				if !names[name] {
+					t.Errorf("%s %s: parameter %q is not in the path", method, path, name)
+				}
+				// catch-all parameters must be the last segments of paths
+				if param["x-catch-all"] == true && !strings.HasSuffix(path, "/{"+name+"}") {
+					t.Errorf("%s %s: catch-all parameter %q is not at the end", method, path, name)
+				}
+			}
+			for name := range names {
+				if !declared[name] {
+					t.Errorf("%s %s: parameter %q is not declared", method, path, name)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPICatchAllParams(t *testing.T) {
+	s := newTestServer()
+	paths := s.OpenAPIDocument()["paths"].(map[string]interface{})
+	tests := []struct {
+		path  string
+		param string
+	}{
+		{"/{siteName}/{userName}/{repoName}/blob/{rev}/{path}", "path"},
+		{"/{siteName}/{userName}/{repoName}/tree/{rev}/{path}", "path"},
+		{"/{siteName}/{userName}/{repoName}/{rev}/{path}", "path"},
+		{"/{siteName}/{userName}/{repoName}/resolve/{rev}", "rev"},
+		{"/{siteName}/{userName}/{repoName}/feed/commits/{branch}", "branch"},
+	}
+	for _, tt := range tests {
+		op := paths[tt.path].(map[string]interface{})["get"].(map[string]interface{})
+		found := false
+		for _, v := range op["parameters"].([]interface{}) {
+			param := v.(map[string]interface{})
+			if param["name"] != tt.param || param["in"] != "path" {
+				continue
+			}
+			found = true
+			if param["x-catch-all"] != true || !strings.Contains(param["description"].(string), "slashes") {
+				t.Errorf("%s: parameter %q = %v, want a catch-all", tt.path, tt.param, param)
+			}
+		}
+		if !found {
+			t.Errorf("%s: parameter %q is not declared", tt.path, tt.param)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// repoRoute is a GET route relative to /:siteName/:userName/:repoName
+type repoRoute struct {
+	// pattern consists of static segments, ":name" segments and an optional trailing "*name" as gin routes do
+	pattern string
+	handler gin.HandlerFunc
+}
+
+func cutSegment(path string) (string, string) {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+// match returns parameters of the path if it matches the pattern
+func (route *repoRoute) match(path string) (gin.Params, bool) {
+	params := make(gin.Params, 0)
+	pattern := route.pattern
+	for pattern != "" {
+		var segment string
+		segment, pattern = cutSegment(pattern[1:])
+		if strings.HasPrefix(segment, "*") {
+			// the rest of the path with the leading slash as gin does
+			return append(params, gin.Param{Key: segment[1:], Value: path}), true
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, false
+		}
+		var value string
+		value, path = cutSegment(path[1:])
+		if strings.HasPrefix(segment, ":") {
+			if value == "" {
+				return nil, false
+			}
+			params = append(params, gin.Param{Key: segment[1:], Value: value})
+		} else if value != segment {
+			return nil, false
+		}
+	}
+	return params, path == "" || path == "/"
+}
+
+// repoRouter returns a handler dispatching GET requests under a repo to routes of static, blob-only or full mode.
+// Since the mode is a setting of each repo, the route of the repo is chosen after looking up the repo
+// so that revisions of blob-only repos and files of static sites are never taken for names of routes of full mode.
+func repoRouter(s *Server, fullRoutes []*repoRoute, blobOnlyRoutes []*repoRoute, staticRoutes []*repoRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := s.lookupRepoSettings(c)
+		if settings == nil {
+			// unknown repos are reported by handlers
+			settings = &RepoSettings{}
+		}
+		routes := fullRoutes
+		if s.isStatic(settings) {
+			routes = staticRoutes
+		} else if s.isBlobOnly(settings) {
+			routes = blobOnlyRoutes
+		}
+		path := c.Param("path")
+		for _, route := range routes {
+			params, ok := route.match(path)
+			if !ok {
+				continue
+			}
+			c.Params = append(gin.Params{
+				{Key: "siteName", Value: c.Param("siteName")},
+				{Key: "userName", Value: c.Param("userName")},
+				{Key: "repoName", Value: c.Param("repoName")},
+			}, params...)
+			route.handler(c)
+			return
+		}
+		c.JSON(404, gin.H{"ok": false, "error": "not found"})
+	}
+}
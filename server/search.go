@@ -0,0 +1,212 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/taskie/gitan/index"
+	"github.com/taskie/gitan/repo"
+)
+
+const (
+	defaultIndexRefreshInterval = 5 * time.Minute
+	searchMaxResults            = 100
+	commitSearchMaxResults      = 1000
+)
+
+func (s *Server) updateIndex() {
+	for siteName, site := range s.Sites {
+		for userName, user := range site.UserRegistries {
+			for repoName, r := range user.Repos {
+				settings := user.RepoSettings(repoName)
+				if settings.Hidden {
+					continue
+				}
+				key := index.RepoKey{Site: siteName, User: userName, Repo: repoName}
+				err := s.Index.Update(key, r, settings.defaultRev())
+				if err != nil {
+					log.Warnf("indexing %s/%s/%s failed: %s", siteName, userName, repoName, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) runIndexer() {
+	for {
+		s.updateIndex()
+		time.Sleep(s.IndexRefreshInterval)
+	}
+}
+
+func searchHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		q := c.Query("q")
+		if q == "" {
+			c.JSON(400, gin.H{"ok": false, "error": "no query: q"})
+			return
+		}
+		maxResults := searchMaxResults
+		if max, err := strconv.Atoi(c.Query("max")); err == nil && max > 0 && max < maxResults {
+			maxResults = max
+		}
+		results, err := s.Index.Search(&index.Query{
+			RepoKey: index.RepoKey{
+				Site: c.Query("site"),
+				User: c.Query("user"),
+				Repo: c.Query("repo"),
+			},
+			Text:            q,
+			CaseInsensitive: c.Query("i") == "true",
+			MaxResults:      maxResults,
+		})
+		if err != nil {
+			c.JSON(400, gin.H{"ok": false, "error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"ok": true, "results": results})
+		}
+	}
+}
+
+type CommitSearchResult struct {
+	Site   string       `json:"site"`
+	User   string       `json:"user"`
+	Repo   string       `json:"repo"`
+	Commit *repo.Commit `json:"commit"`
+}
+
+func parseDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s", s)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func parseCommitQuery(c *gin.Context) (*repo.CommitQuery, int, error) {
+	since, err := parseDate(c.Query("since"), false)
+	if err != nil {
+		return nil, 0, err
+	}
+	until, err := parseDate(c.Query("until"), true)
+	if err != nil {
+		return nil, 0, err
+	}
+	maxResults := commitSearchMaxResults
+	if max, err := strconv.Atoi(c.Query("max")); err == nil && max > 0 && max < maxResults {
+		maxResults = max
+	}
+	q := &repo.CommitQuery{
+		Message:    c.Query("q"),
+		Regexp:     c.Query("regexp") == "true",
+		IgnoreCase: c.Query("i") == "true",
+		Author:     c.Query("author"),
+		Committer:  c.Query("committer"),
+		Since:      since,
+		Until:      until,
+	}
+	err = q.Validate()
+	if err != nil {
+		return nil, 0, err
+	}
+	return q, maxResults, nil
+}
+
+func commitSearchHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		q, maxResults, err := parseCommitQuery(c)
+		if err != nil {
+			c.JSON(400, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		commits, err := r.SearchCommits(c.Query("rev"), q, maxResults)
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"ok": true, "commits": commits})
+		}
+	}
+}
+
+func globalCommitSearchHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		q, maxResults, err := parseCommitQuery(c)
+		if err != nil {
+			c.JSON(400, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		rev := c.Query("rev")
+		results := make([]*CommitSearchResult, 0)
+		for siteName, site := range s.Sites {
+			if c.Query("site") != "" && c.Query("site") != siteName {
+				continue
+			}
+			for userName, user := range site.UserRegistries {
+				if c.Query("user") != "" && c.Query("user") != userName {
+					continue
+				}
+				for repoName, r := range user.Repos {
+					if c.Query("repo") != "" && c.Query("repo") != repoName {
+						continue
+					}
+					if user.RepoSettings(repoName).Hidden {
+						continue
+					}
+					commits, err := r.SearchCommits(rev, q, maxResults)
+					if err != nil {
+						// the query is already validated, so the error is of the repo (e.g. the rev does not exist in it)
+						log.Debugf("searching commits of %s/%s/%s failed: %s", siteName, userName, repoName, err)
+						continue
+					}
+					for _, commit := range commits {
+						results = append(results, &CommitSearchResult{
+							Site:   siteName,
+							User:   userName,
+							Repo:   repoName,
+							Commit: commit,
+						})
+					}
+				}
+			}
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Commit.Committer.When.After(results[j].Commit.Committer.When)
+		})
+		if len(results) > maxResults {
+			results = results[:maxResults]
+		}
+		c.JSON(200, gin.H{"ok": true, "commits": results})
+	}
+}
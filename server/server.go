@@ -2,13 +2,15 @@ package server
 
 import (
 	"fmt"
-	"mime"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"github.com/taskie/gitan/graphql"
+	"github.com/taskie/gitan/index"
 	"github.com/taskie/gitan/repo"
 	"github.com/taskie/jc"
 )
@@ -20,6 +22,30 @@ type Config struct {
 	BlobOnly     bool                   `json:"blob_only" toml:"blob_only"`
 	TreeMaxDepth int                    `json:"tree_max_depth" toml:"tree_max_depth"`
 	BathPath     string                 `json:"base_path" toml:"base_path"`
+	Index        *IndexConfig           `json:"index" toml:"index"`
+	// FollowSymlinks is the default of follow_symlinks query of blob requests
+	FollowSymlinks bool `json:"follow_symlinks" toml:"follow_symlinks"`
+	// Static configures static site hosting of repos whose static setting is true
+	Static *StaticConfig `json:"static" toml:"static"`
+	// RepoOverrides are applied in order to every repo including ones found in Roots
+	RepoOverrides []*RepoOverrideConfig `json:"repo_overrides" toml:"repo_overrides"`
+	// MaxOpenRepos is the number of repos kept open at once (repos are opened on first request);
+	// each open repo caches up to 4 MiB of objects (repo.PoolObjectCacheSize)
+	MaxOpenRepos int `json:"max_open_repos" toml:"max_open_repos"`
+	// Cache enables caching of resolved revisions, trees, commits and rendered responses
+	Cache *CacheConfig `json:"cache" toml:"cache"`
+	// CommitGraph enables writing commit graphs of repos which have no commit-graph of git
+	CommitGraph *CommitGraphConfig `json:"commit_graph" toml:"commit_graph"`
+	// GitPath is the git command used by repos whose backend is "git"
+	GitPath string `json:"git_path" toml:"git_path"`
+	// GraphQL configures limits of queries to the /graphql endpoint
+	GraphQL *GraphQLConfig `json:"graphql" toml:"graphql"`
+}
+
+type IndexConfig struct {
+	Path string `json:"path" toml:"path"`
+	// RefreshInterval is the interval in seconds to check whether HEAD of each repo has moved
+	RefreshInterval int `json:"refresh_interval" toml:"refresh_interval"`
 }
 
 type SiteConfig struct {
@@ -32,26 +58,51 @@ type UserRegistryConfig struct {
 
 type RepoConfig struct {
 	Path string `json:"path" toml:"path"`
+	RepoSettings
 }
 
 func NewServer(conf *Config) (*Server, error) {
-	sites := make(map[string]*Site)
+	basePath := conf.BathPath
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	if !strings.HasSuffix(basePath, "/") {
+		basePath += "/"
+	}
+	cache, err := newCache(conf.Cache)
+	if err != nil {
+		return nil, err
+	}
+	srv := Server{
+		Address:        conf.Address,
+		Sites:          make(map[string]*Site),
+		BlobOnly:       conf.BlobOnly,
+		TreeMaxDepth:   conf.TreeMaxDepth,
+		BathPath:       basePath,
+		FollowSymlinks: conf.FollowSymlinks,
+		Cache:          cache,
+	}
+	pool := repo.NewPool(conf.MaxOpenRepos)
+	addRepo := func(siteName, userName, repoName, path string, repoSettings *RepoSettings) error {
+		r := repo.NewLazyRepo(path, pool)
+		settings := newRepoSettings(conf.RepoOverrides, siteName, userName, repoName, repoSettings)
+		backend, err := newBackend(settings, conf.GitPath, r)
+		if err != nil {
+			return err
+		}
+		r.SetBackend(backend)
+		r.SetCommitGraphPath(commitGraphPath(conf.CommitGraph, siteName, userName, repoName))
+		srv.AddRepo(siteName, userName, repoName, r, settings)
+		return nil
+	}
 	if conf.Roots != nil {
 		for _, rootConf := range conf.Roots {
 			root, err := NewRoot(rootConf)
 			if err != nil {
 				return nil, err
 			}
-			site := sites[root.siteName]
-			if site == nil {
-				site = NewSite()
-				sites[root.siteName] = site
-			}
+			srv.site(root.siteName)
 			for _, foundRepo := range root.Collect() {
-				r, err := repo.NewRepo(foundRepo.Path)
-				if err != nil {
-					return nil, err
-				}
 				log.Infof("found %s: %s", foundRepo.Name, foundRepo.Path)
 				parts := strings.SplitN(foundRepo.Name, "/", 2)
 				var userName, repoName string
@@ -62,59 +113,90 @@ func NewServer(conf *Config) (*Server, error) {
 					userName = "-"
 					repoName = foundRepo.Name
 				}
-				user := site.UserRegistries[userName]
-				if user == nil {
-					user = NewUserRegistry()
-					site.UserRegistries[userName] = user
+				err := addRepo(root.siteName, userName, repoName, foundRepo.Path, nil)
+				if err != nil {
+					return nil, err
 				}
-				user.Repos[repoName] = r
 			}
 		}
 	}
 	for siteName, siteConf := range conf.Sites {
 		for userName, userConf := range siteConf.UserRegistries {
 			for repoName, repoConf := range userConf.Repos {
-				r, err := repo.NewRepo(repoConf.Path)
+				err := addRepo(siteName, userName, repoName, repoConf.Path, &repoConf.RepoSettings)
 				if err != nil {
 					return nil, err
 				}
-				site := sites[siteName]
-				if site == nil {
-					site = NewSite()
-					sites[siteName] = site
-				}
-				user := site.UserRegistries[userName]
-				if user == nil {
-					user = NewUserRegistry()
-					site.UserRegistries[userName] = user
-				}
-				user.Repos[repoName] = r
 			}
 		}
 	}
-	basePath := conf.BathPath
-	if !strings.HasPrefix(basePath, "/") {
-		basePath = "/" + basePath
+	if conf.CommitGraph != nil && conf.CommitGraph.Path != "" {
+		srv.CommitGraphRefreshInterval = time.Duration(conf.CommitGraph.RefreshInterval) * time.Second
+		if srv.CommitGraphRefreshInterval <= 0 {
+			srv.CommitGraphRefreshInterval = defaultCommitGraphRefreshInterval
+		}
 	}
-	if !strings.HasSuffix(basePath, "/") {
-		basePath += "/"
+	srv.GraphQL = newGraphQLSchema(&srv, conf.GraphQL)
+	if conf.Static != nil {
+		srv.Static = newStaticConfig(conf.Static)
 	}
-	srv := Server{
-		Address:      conf.Address,
-		Sites:        sites,
-		BlobOnly:     conf.BlobOnly,
-		TreeMaxDepth: conf.TreeMaxDepth,
-		BathPath:     basePath,
+	if conf.Index != nil && conf.Index.Path != "" {
+		ix, err := index.NewIndex(conf.Index.Path)
+		if err != nil {
+			return nil, err
+		}
+		srv.Index = ix
+		srv.IndexRefreshInterval = time.Duration(conf.Index.RefreshInterval) * time.Second
+		if srv.IndexRefreshInterval <= 0 {
+			srv.IndexRefreshInterval = defaultIndexRefreshInterval
+		}
 	}
 	return &srv, nil
 }
 
+func (s *Server) site(siteName string) *Site {
+	if s.Sites == nil {
+		s.Sites = make(map[string]*Site)
+	}
+	site := s.Sites[siteName]
+	if site == nil {
+		site = NewSite()
+		s.Sites[siteName] = site
+	}
+	return site
+}
+
+// AddRepo registers the repo (e.g. one constructed on memory storage) to be served; settings may be nil
+func (s *Server) AddRepo(siteName, userName, repoName string, r *repo.Repo, settings *RepoSettings) {
+	if settings == nil {
+		settings = &RepoSettings{}
+	}
+	site := s.site(siteName)
+	user := site.UserRegistries[userName]
+	if user == nil {
+		user = NewUserRegistry()
+		site.UserRegistries[userName] = user
+	}
+	r.SetAllowedRefs(settings.AllowedRefs)
+	r.SetCache(s.Cache)
+	user.Repos[repoName] = r
+	user.Settings[repoName] = settings
+}
+
 type Server struct {
-	Address      string
-	Sites        map[string]*Site
-	BlobOnly     bool
-	TreeMaxDepth int
-	BathPath     string
+	Address              string
+	Sites                map[string]*Site
+	BlobOnly             bool
+	TreeMaxDepth         int
+	BathPath             string
+	Index                *index.Index
+	IndexRefreshInterval time.Duration
+	FollowSymlinks       bool
+	Static               *StaticConfig
+	Cache                *repo.Cache
+	// CommitGraphRefreshInterval is the interval to update commit graphs; zero disables them
+	CommitGraphRefreshInterval time.Duration
+	GraphQL                    *graphql.Schema
 }
 
 type Site struct {
@@ -128,32 +210,78 @@ func NewSite() *Site {
 }
 
 type UserRegistry struct {
-	Repos map[string]*repo.Repo
+	Repos    map[string]*repo.Repo
+	Settings map[string]*RepoSettings
 }
 
 func NewUserRegistry() *UserRegistry {
 	return &UserRegistry{
-		Repos: make(map[string]*repo.Repo),
+		Repos:    make(map[string]*repo.Repo),
+		Settings: make(map[string]*RepoSettings),
 	}
 }
 
-func (s *Server) Run() {
+// Router returns the handler of the routes of s without starting background jobs (e.g. to embed or test s)
+func (s *Server) Router() *gin.Engine {
 	r := gin.Default()
 	rootGroup := r.Group(s.BathPath)
 	rootGroup.GET("/", listSitesHandler(s))
+	rootGroup.GET("/search/commits", globalCommitSearchHandler(s))
+	if s.GraphQL == nil {
+		s.GraphQL = newGraphQLSchema(s, nil)
+	}
+	if s.Static == nil {
+		s.Static = newStaticConfig(&StaticConfig{})
+	}
+	rootGroup.GET("/graphql", graphQLHandler(s))
+	rootGroup.POST("/graphql", graphQLHandler(s))
+	rootGroup.GET("/openapi.json", openAPIHandler(s))
+	if s.Index != nil {
+		rootGroup.GET("/search", searchHandler(s))
+	}
 	var repoGroup *gin.RouterGroup
 	siteGroup := rootGroup.Group("/:siteName/")
 	siteGroup.GET("/", listUsersHandler(s))
 	siteGroup.GET("/:userName/", listReposHandler(s))
 	repoGroup = siteGroup.Group("/:userName/:repoName")
-	if s.BlobOnly {
-		repoGroup.GET("/:rev/*path", blobHandler(s))
-	} else {
-		repoGroup.GET("", revsHandler(s))
-		repoGroup.GET("/blob/:rev/*path", blobHandler(s))
-		repoGroup.GET("/tree/:rev/*path", treeHandler(s))
-		repoGroup.GET("/cat/:hash", catHandler(s))
-		repoGroup.GET("/commit/:rev", commitHandler(s))
+	fullRoutes := []*repoRoute{
+		{"", revsHandler(s)},
+		{"/blob/:rev/*path", blobHandler(s)},
+		{"/tree/:rev/*path", cacheResponse(s, "tree", treeHandler(s))},
+		{"/cat/:hash", catHandler(s)},
+		{"/commit/:rev", cacheResponse(s, "commit", commitHandler(s))},
+		{"/resolve/*rev", resolveHandler(s)},
+		{"/log/:rev", cacheResponse(s, "log", logHandler(s))},
+		{"/grep/:rev", cacheResponse(s, "grep", grepHandler(s))},
+		{"/search/commits", commitSearchHandler(s)},
+		{"/feed/commits/*branch", commitsFeedHandler(s)},
+		{"/feed/tags.atom", tagsFeedHandler(s, "atom")},
+		{"/feed/tags.rss", tagsFeedHandler(s, "rss")},
+		{"/info/lfs/objects/:oid", lfsObjectHandler(s)},
+	}
+	blobOnlyRoutes := []*repoRoute{
+		{"/:rev/*path", blobHandler(s)},
+	}
+	staticRoutes := []*repoRoute{
+		{"/*path", staticHandler(s)},
+	}
+	// BlobOnly and Static are settings of each repo, so GET routes are dispatched after looking up the repo
+	router := repoRouter(s, fullRoutes, blobOnlyRoutes, staticRoutes)
+	repoGroup.GET("", router)
+	repoGroup.GET("/*path", router)
+	fullGroup := repoGroup.Group("", requireFullMode(s))
+	fullGroup.POST("/batch", batchHandler(s))
+	fullGroup.POST("/info/lfs/objects/batch", lfsBatchHandler(s))
+	return r
+}
+
+func (s *Server) Run() {
+	r := s.Router()
+	if s.CommitGraphRefreshInterval > 0 {
+		go s.runCommitGraphWriter()
+	}
+	if s.Index != nil {
+		go s.runIndexer()
 	}
 	if s.Address != "" {
 		r.Run(s.Address)
@@ -183,7 +311,10 @@ type UserSpec struct {
 }
 
 type RepoSpec struct {
-	Name string `json:"name"`
+	Name        string         `json:"name"`
+	DisplayName string         `json:"display_name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Metadata    *repo.Metadata `json:"metadata,omitempty"`
 }
 
 func listSitesHandler(s *Server) func(c *gin.Context) {
@@ -205,6 +336,10 @@ func listUsersHandler(s *Server) func(c *gin.Context) {
 			siteNotFound(c, siteName)
 			return
 		}
+		if c.Query("format") != "" {
+			siteFeed(s, c, siteName, site)
+			return
+		}
 		users := make([]*UserSpec, 0)
 		for userName := range site.UserRegistries {
 			users = append(users, &UserSpec{userName})
@@ -228,9 +363,30 @@ func listReposHandler(s *Server) func(c *gin.Context) {
 			userNotFound(c, userName)
 			return
 		}
+		if c.Query("format") != "" {
+			userFeed(s, c, siteName, userName, user)
+			return
+		}
+		withMetadata := c.Query("metadata") == "true"
 		repos := make([]*RepoSpec, 0)
-		for repoName := range user.Repos {
-			repos = append(repos, &RepoSpec{repoName})
+		for repoName, r := range user.Repos {
+			settings := user.RepoSettings(repoName)
+			if settings.Hidden {
+				continue
+			}
+			spec := &RepoSpec{
+				Name:        repoName,
+				DisplayName: settings.DisplayName,
+				Description: settings.Description,
+			}
+			if withMetadata {
+				meta, err := repoMetadata(r, settings)
+				if err != nil {
+					log.Warnf("obtaining metadata of %s failed: %s", repoName, err)
+				}
+				spec.Metadata = meta
+			}
+			repos = append(repos, spec)
 		}
 		sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
 		c.JSON(200, gin.H{"ok": true, "repos": repos})
@@ -290,19 +446,23 @@ func blobHandler(s *Server) func(c *gin.Context) {
 		path := strings.TrimLeft(c.Param("path"), "/")
 		// pp.Println(s)
 		log.Println(repoName, path, rev, repo)
+		followSymlinks := s.FollowSymlinks
+		if q := c.Query("follow_symlinks"); q != "" {
+			followSymlinks = q == "true"
+		}
+		if followSymlinks {
+			resolved, err := repo.ResolveSymlinks(path, rev)
+			if err != nil {
+				c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+				return
+			}
+			path = resolved
+		}
 		bs, stat, err := repo.GetFile(path, rev)
 		if err != nil {
 			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
 		} else {
-			ty := mime.TypeByExtension(filepath.Ext(path))
-			if ty == "" {
-				if stat.IsBinary {
-					ty = "application/octet-stream"
-				} else {
-					ty = "text/plain"
-				}
-			}
-			c.Data(200, ty, bs)
+			c.Data(200, contentType(path, stat), bs)
 		}
 	}
 }
@@ -329,13 +489,34 @@ func revsHandler(s *Server) func(c *gin.Context) {
 		}
 		// pp.Println(s)
 		log.Println(repoName)
+		settings := user.RepoSettings(repoName)
 		branches, err := repo.GetBranches()
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		meta, err := repoMetadata(repo, settings)
 		if err != nil {
 			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
 		} else {
-			c.JSON(200, gin.H{"ok": true, "branches": branches})
+			c.JSON(200, gin.H{"ok": true, "branches": branches, "metadata": meta})
+		}
+	}
+}
+
+func parseTreeExpansion(expand string) *repo.TreeExpansion {
+	exp := &repo.TreeExpansion{}
+	for _, field := range strings.Split(expand, ",") {
+		switch strings.TrimSpace(field) {
+		case "size":
+			exp.Size = true
+		case "type":
+			exp.Type = true
+		case "last_commit":
+			exp.LastCommit = true
 		}
 	}
+	return exp
 }
 
 func treeHandler(s *Server) func(c *gin.Context) {
@@ -364,13 +545,45 @@ func treeHandler(s *Server) func(c *gin.Context) {
 		log.Println(repoName, path, rev, r)
 		var tes []*repo.TreeEntry
 		var err error
-		if s.TreeMaxDepth != 0 && c.Query("recursive") == "true" {
-			tes, err = r.Find(path, rev, s.TreeMaxDepth)
-		} else {
-			tes, err = r.GetTree(path, rev)
+		submodules := make([]*repo.Submodule, 0)
+		stream := wantsNDJSON(c)
+		var opts *repo.FindOptions
+		for {
+			maxDepth := s.treeMaxDepth(s.Sites[siteName].UserRegistries[userName].RepoSettings(repoName))
+			opts = nil
+			if maxDepth != 0 && c.Query("recursive") == "true" {
+				opts = findOptions(c, maxDepth)
+			}
+			if opts != nil && !stream {
+				tes, err = r.FindWithOptions(path, rev, opts)
+			} else {
+				tes, err = r.GetTree(path, rev)
+			}
+			if err == nil || len(submodules) >= maxSubmoduleDepth {
+				break
+			}
+			// descend into the submodule if it is hosted by this server
+			sm, rest, serr := r.FindSubmodule(rev, path)
+			if serr != nil || sm == nil || !s.linkSubmodule(siteName, userName, repoName, sm) {
+				break
+			}
+			submodules = append(submodules, sm)
+			siteName, userName, repoName = sm.Site, sm.User, sm.Repo
+			r = s.Sites[siteName].UserRegistries[userName].Repos[repoName]
+			rev, path = sm.CommitID, rest
+		}
+		if err == nil && opts != nil && stream {
+			streamTreeEntries(s, c, siteName, userName, repoName, r, rev, path, opts)
+			return
+		}
+		if err == nil {
+			s.linkSubmodules(siteName, userName, repoName, tes)
+			err = r.ExpandTreeEntries(rev, path, tes, parseTreeExpansion(c.Query("expand")))
 		}
 		if err != nil {
 			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+		} else if len(submodules) > 0 {
+			c.JSON(200, gin.H{"ok": true, "entries": tes, "submodules": submodules})
 		} else {
 			c.JSON(200, gin.H{"ok": true, "entries": tes})
 		}
@@ -407,6 +620,130 @@ func commitHandler(s *Server) func(c *gin.Context) {
 	}
 }
 
+func resolveHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		rev := strings.TrimLeft(c.Param("rev"), "/")
+		resolved, err := r.ResolveRevision(rev)
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"ok": true, "revision": resolved})
+		}
+	}
+}
+
+const logMaxResults = 1000
+
+func logHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		rev := c.Param("rev")
+		maxResults := logMaxResults
+		if max, err := strconv.Atoi(c.Query("max")); err == nil && max > 0 && max < maxResults {
+			maxResults = max
+		}
+		var commits []*repo.Commit
+		var err error
+		if pickaxe := c.Query("pickaxe"); pickaxe != "" {
+			commits, err = r.Pickaxe(rev, &repo.PickaxeQuery{
+				Pattern:   pickaxe,
+				Regexp:    c.Query("regexp") == "true",
+				PathGlobs: c.QueryArray("path"),
+			}, maxResults)
+		} else {
+			commits, err = r.GetLog(rev, maxResults)
+		}
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"ok": true, "commits": commits})
+		}
+	}
+}
+
+const grepMaxResults = 1000
+
+func grepHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, userName)
+			return
+		}
+		rev := c.Param("rev")
+		q := c.Query("q")
+		if q == "" {
+			c.JSON(400, gin.H{"ok": false, "error": "no query: q"})
+			return
+		}
+		caseInsensitive := c.Query("i") == "true"
+		// invalid patterns are errors of the request rather than missing revisions
+		_, err := repo.CompileGrepPattern(q, caseInsensitive)
+		if err != nil {
+			c.JSON(400, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		maxResults := grepMaxResults
+		if max, err := strconv.Atoi(c.Query("max")); err == nil && max > 0 && max < maxResults {
+			maxResults = max
+		}
+		matches, err := r.Grep(rev, q, c.QueryArray("path"), caseInsensitive, maxResults)
+		if err != nil {
+			c.JSON(404, gin.H{"ok": false, "error": err.Error()})
+		} else {
+			c.JSON(200, gin.H{"ok": true, "matches": matches})
+		}
+	}
+}
+
 func Main(args []string) {
 	path := "gitan.json"
 	if len(args) > 1 {
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrepHandler(t *testing.T) {
+	s := newTestServer()
+	mr := newMemoryRepo(t)
+	mr.commit("c1", map[string]string{"a.txt": "foo\nbar\n"})
+	s.AddRepo("s", "u", "r", mr.open(), nil)
+	router := s.Router()
+
+	var res struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error"`
+		Matches []struct {
+			Path       string `json:"path"`
+			LineNumber int    `json:"line_number"`
+		} `json:"matches"`
+	}
+	w := get(t, router, "/s/u/r/grep/master?q=BA.&i=true", &res)
+	if w.Code != 200 || len(res.Matches) != 1 || res.Matches[0].Path != "a.txt" || res.Matches[0].LineNumber != 2 {
+		t.Errorf("GET grep = %d %s", w.Code, w.Body.String())
+	}
+
+	for _, q := range []string{"(", "a**", "[z-a]"} {
+		res.Error = ""
+		w = get(t, router, "/s/u/r/grep/master?q="+q, &res)
+		if w.Code != 400 || !strings.Contains(res.Error, "invalid pattern") {
+			t.Errorf("GET grep of %q = %d %s, want 400", q, w.Code, w.Body.String())
+		}
+	}
+	w = get(t, router, "/s/u/r/grep/master", nil)
+	if w.Code != 400 {
+		t.Errorf("GET grep without q = %d, want 400", w.Code)
+	}
+	w = get(t, router, "/s/u/r/grep/missing?q=foo", nil)
+	if w.Code != 404 {
+		t.Errorf("GET grep of a missing revision = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+// RepoSettings are per-repo settings which override the server-wide ones
+type RepoSettings struct {
+	DisplayName string `json:"display_name" toml:"display_name"`
+	Description string `json:"description" toml:"description"`
+	// DefaultBranch is used instead of HEAD for feeds, search indexes and metadata
+	DefaultBranch string `json:"default_branch" toml:"default_branch"`
+	// Hidden repos are accessible but not listed nor aggregated
+	Hidden       bool  `json:"hidden" toml:"hidden"`
+	BlobOnly     *bool `json:"blob_only" toml:"blob_only"`
+	TreeMaxDepth *int  `json:"tree_max_depth" toml:"tree_max_depth"`
+	// AllowedRefs are glob patterns of ref names (e.g. "refs/tags/v*"); empty allows every ref.
+	// Blobs and LFS objects are not served by hash nor oid for repos with allowed refs.
+	AllowedRefs     []string `json:"allowed_refs" toml:"allowed_refs"`
+	PublishedBranch string   `json:"published_branch" toml:"published_branch"`
+	// Static serves the published branch as a static site instead of the API of the repo (see Config.Static)
+	Static *bool `json:"static" toml:"static"`
+	// Backend is "go-git" (default) or "git" to read objects with the git command
+	Backend string `json:"backend" toml:"backend"`
+}
+
+// RepoOverrideConfig applies settings to every repo whose "site/user/repo" name matches Pattern
+type RepoOverrideConfig struct {
+	Pattern string `json:"pattern" toml:"pattern"`
+	RepoSettings
+}
+
+// merge overwrites settings with non-zero fields of other
+func (settings *RepoSettings) merge(other *RepoSettings) {
+	if other.DisplayName != "" {
+		settings.DisplayName = other.DisplayName
+	}
+	if other.Description != "" {
+		settings.Description = other.Description
+	}
+	if other.DefaultBranch != "" {
+		settings.DefaultBranch = other.DefaultBranch
+	}
+	if other.Hidden {
+		settings.Hidden = true
+	}
+	if other.BlobOnly != nil {
+		settings.BlobOnly = other.BlobOnly
+	}
+	if other.TreeMaxDepth != nil {
+		settings.TreeMaxDepth = other.TreeMaxDepth
+	}
+	if other.AllowedRefs != nil {
+		settings.AllowedRefs = other.AllowedRefs
+	}
+	if other.PublishedBranch != "" {
+		settings.PublishedBranch = other.PublishedBranch
+	}
+	if other.Static != nil {
+		settings.Static = other.Static
+	}
+	if other.Backend != "" {
+		settings.Backend = other.Backend
+	}
+}
+
+func newRepoSettings(overrides []*RepoOverrideConfig, siteName, userName, repoName string, conf *RepoSettings) *RepoSettings {
+	settings := &RepoSettings{}
+	name := siteName + "/" + userName + "/" + repoName
+	for _, override := range overrides {
+		if repo.MatchGlob(override.Pattern, name) {
+			settings.merge(&override.RepoSettings)
+		}
+	}
+	if conf != nil {
+		settings.merge(conf)
+	}
+	return settings
+}
+
+// defaultRev returns the revision used when none is specified
+func (settings *RepoSettings) defaultRev() string {
+	if settings.DefaultBranch != "" {
+		return settings.DefaultBranch
+	}
+	return "HEAD"
+}
+
+func (s *Server) isBlobOnly(settings *RepoSettings) bool {
+	if settings.BlobOnly != nil {
+		return *settings.BlobOnly
+	}
+	return s.BlobOnly
+}
+
+func (s *Server) isStatic(settings *RepoSettings) bool {
+	return settings.Static != nil && *settings.Static
+}
+
+func (s *Server) treeMaxDepth(settings *RepoSettings) int {
+	if settings.TreeMaxDepth != nil {
+		return *settings.TreeMaxDepth
+	}
+	return s.TreeMaxDepth
+}
+
+// newBackend returns the backend selected by settings; nil means the default go-git one
+func newBackend(settings *RepoSettings, gitPath string, r *repo.Repo) (repo.Backend, error) {
+	switch settings.Backend {
+	case "", "go-git":
+		return nil, nil
+	case "git":
+		return repo.NewGitCLIBackend(gitPath, r.GitDir()), nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", settings.Backend)
+	}
+}
+
+// RepoSettings returns the settings of the repo (never nil)
+func (u *UserRegistry) RepoSettings(repoName string) *RepoSettings {
+	if settings := u.Settings[repoName]; settings != nil {
+		return settings
+	}
+	return &RepoSettings{}
+}
+
+func (s *Server) lookupRepoSettings(c *gin.Context) *RepoSettings {
+	site := s.Sites[c.Param("siteName")]
+	if site == nil {
+		return nil
+	}
+	user := site.UserRegistries[c.Param("userName")]
+	if user == nil || user.Repos[c.Param("repoName")] == nil {
+		return nil
+	}
+	return user.RepoSettings(c.Param("repoName"))
+}
+
+// requireFullMode returns a middleware which serves the request only if the repo is neither static nor blob-only.
+// Unknown repos are passed through to let handlers report them.
+func requireFullMode(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings := s.lookupRepoSettings(c)
+		if settings != nil && (s.isStatic(settings) || s.isBlobOnly(settings)) {
+			c.AbortWithStatusJSON(404, gin.H{"ok": false, "error": "not found"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// repoMetadata returns the metadata of the repo overridden by settings
+func repoMetadata(r *repo.Repo, settings *RepoSettings) (*repo.Metadata, error) {
+	meta, err := r.GetMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if settings.Description != "" {
+		meta.Description = settings.Description
+	}
+	if settings.DefaultBranch != "" {
+		meta.DefaultBranch = settings.DefaultBranch
+	}
+	return meta, nil
+}
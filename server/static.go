@@ -0,0 +1,143 @@
+package server
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+type StaticConfig struct {
+	// Branch is the published branch of repos which do not set published_branch
+	Branch       string `json:"branch" toml:"branch"`
+	IndexFile    string `json:"index_file" toml:"index_file"`
+	NotFoundPage string `json:"not_found_page" toml:"not_found_page"`
+	// PrettyURLs serves "/about" from "about.html"
+	PrettyURLs bool `json:"pretty_urls" toml:"pretty_urls"`
+}
+
+func newStaticConfig(conf *StaticConfig) *StaticConfig {
+	static := *conf
+	if static.Branch == "" {
+		static.Branch = "gh-pages"
+	}
+	if static.IndexFile == "" {
+		static.IndexFile = "index.html"
+	}
+	if static.NotFoundPage == "" {
+		static.NotFoundPage = "404.html"
+	}
+	return &static
+}
+
+// extraMIMETypes complements mime.TypeByExtension for assets commonly found in static sites
+var extraMIMETypes = map[string]string{
+	".ico":         "image/vnd.microsoft.icon",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".otf":         "font/otf",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".webmanifest": "application/manifest+json",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".yaml":        "text/yaml; charset=utf-8",
+	".yml":         "text/yaml; charset=utf-8",
+}
+
+func contentType(path string, stat *repo.FileStat) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	ty := mime.TypeByExtension(ext)
+	if ty == "" {
+		ty = extraMIMETypes[ext]
+	}
+	if ty == "" {
+		if stat.IsBinary || stat.LFSOID != "" {
+			ty = "application/octet-stream"
+		} else {
+			ty = "text/plain"
+		}
+	}
+	return ty
+}
+
+func (s *Server) publishedBranch(user *UserRegistry, repoName string) string {
+	if branch := user.RepoSettings(repoName).PublishedBranch; branch != "" {
+		return branch
+	}
+	return s.Static.Branch
+}
+
+func staticHandler(s *Server) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		siteName := c.Param("siteName")
+		site := s.Sites[siteName]
+		if site == nil {
+			siteNotFound(c, siteName)
+			return
+		}
+		userName := c.Param("userName")
+		user := site.UserRegistries[userName]
+		if user == nil {
+			userNotFound(c, userName)
+			return
+		}
+		repoName := c.Param("repoName")
+		r := user.Repos[repoName]
+		if r == nil {
+			repoNotFound(c, repoName)
+			return
+		}
+		rev := s.publishedBranch(user, repoName)
+		path := strings.TrimLeft(c.Param("path"), "/")
+		followSymlinks := s.FollowSymlinks
+		if q := c.Query("follow_symlinks"); q != "" {
+			followSymlinks = q == "true"
+		}
+		resolve := func(p string) (string, bool) {
+			if !followSymlinks {
+				return p, true
+			}
+			resolved, err := r.ResolveSymlinks(p, rev)
+			return resolved, err == nil
+		}
+		serve := func(p string, code int) bool {
+			p, ok := resolve(p)
+			if !ok {
+				return false
+			}
+			bs, stat, err := r.GetFile(p, rev)
+			if err != nil {
+				return false
+			}
+			c.Data(code, contentType(p, stat), bs)
+			return true
+		}
+		if path == "" || strings.HasSuffix(path, "/") {
+			if serve(path+s.Static.IndexFile, 200) {
+				return
+			}
+		} else {
+			if serve(path, 200) {
+				return
+			}
+			if s.Static.PrettyURLs && serve(path+".html", 200) {
+				return
+			}
+			if dir, ok := resolve(path); ok {
+				if _, err := r.GetTree(dir, rev); err == nil {
+					u := *c.Request.URL
+					u.Path += "/"
+					c.Redirect(301, u.RequestURI())
+					return
+				}
+			}
+		}
+		if serve(s.Static.NotFoundPage, 404) {
+			return
+		}
+		c.String(404, "404 page not found")
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	s := newTestServer()
+	s.Static = newStaticConfig(&StaticConfig{PrettyURLs: true})
+	static := true
+	site := newMemoryRepo(t)
+	h := site.commit("site", map[string]string{
+		"index.html":     "<p>index</p>",
+		"about.html":     "<p>about</p>",
+		"dir/index.html": "<p>dir</p>",
+		"404.html":       "<p>not found</p>",
+		"style.css":      "p {}",
+	})
+	site.setRef("refs/heads/gh-pages", h)
+	s.AddRepo("s", "u", "site", site.open(), &RepoSettings{Static: &static})
+	api := newMemoryRepo(t)
+	api.commit("api", map[string]string{"a.txt": "a"})
+	s.AddRepo("s", "u", "api", api.open(), nil)
+	router := s.Router()
+
+	tests := []struct {
+		path        string
+		code        int
+		body        string
+		contentType string
+	}{
+		{"/s/u/site", 200, "<p>index</p>", "text/html; charset=utf-8"},
+		{"/s/u/site/", 200, "<p>index</p>", "text/html; charset=utf-8"},
+		{"/s/u/site/about", 200, "<p>about</p>", "text/html; charset=utf-8"},
+		{"/s/u/site/about.html", 200, "<p>about</p>", "text/html; charset=utf-8"},
+		{"/s/u/site/dir/", 200, "<p>dir</p>", "text/html; charset=utf-8"},
+		{"/s/u/site/style.css", 200, "p {}", "text/css; charset=utf-8"},
+		{"/s/u/site/missing", 404, "<p>not found</p>", "text/html; charset=utf-8"},
+		// routes of the API are files of static repos
+		{"/s/u/site/tree/HEAD/", 404, "<p>not found</p>", "text/html; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		w := get(t, router, tt.path, nil)
+		if w.Code != tt.code || w.Body.String() != tt.body || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("GET %s = %d %q (%s), want %d %q (%s)",
+				tt.path, w.Code, w.Body.String(), w.Header().Get("Content-Type"), tt.code, tt.body, tt.contentType)
+		}
+	}
+
+	w := get(t, router, "/s/u/site/dir?x=1&y=2", nil)
+	if w.Code != 301 || w.Header().Get("Location") != "/s/u/site/dir/?x=1&y=2" {
+		t.Errorf("GET /s/u/site/dir?x=1&y=2 = %d %q, want a redirect keeping the query", w.Code, w.Header().Get("Location"))
+	}
+
+	w = request(t, router, "POST", "/s/u/site/batch", `{"objects": [{"rev": "master", "path": "index.html"}]}`, nil)
+	if w.Code != 404 {
+		t.Errorf("POST /s/u/site/batch = %d, want 404", w.Code)
+	}
+
+	// other repos of the server are served by the API
+	var tree struct {
+		OK bool `json:"ok"`
+	}
+	w = get(t, router, "/s/u/api/tree/master/", &tree)
+	if w.Code != 200 || !tree.OK {
+		t.Errorf("GET /s/u/api/tree/master/ = %d %s", w.Code, w.Body.String())
+	}
+	w = request(t, router, "POST", "/s/u/api/batch", `{"objects": [{"rev": "master", "path": "a.txt"}]}`, nil)
+	if w.Code != 200 {
+		t.Errorf("POST /s/u/api/batch = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticHandlerWithoutNotFoundPage(t *testing.T) {
+	s := newTestServer()
+	static := true
+	mr := newMemoryRepo(t)
+	mr.commit("site", map[string]string{"about.html": "<p>about</p>"})
+	s.AddRepo("s", "u", "site", mr.open(), &RepoSettings{Static: &static, PublishedBranch: "master"})
+	router := s.Router()
+	for _, path := range []string{"/s/u/site/", "/s/u/site/about"} {
+		// pretty URLs are disabled by default
+		w := get(t, router, path, nil)
+		if w.Code != 404 || w.Body.String() != "404 page not found" {
+			t.Errorf("GET %s = %d %q, want the default 404 page", path, w.Code, w.Body.String())
+		}
+	}
+	w := get(t, router, "/s/u/site/about.html", nil)
+	if w.Code != 200 || w.Body.String() != "<p>about</p>" {
+		t.Errorf("GET /s/u/site/about.html = %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taskie/gitan/repo"
+)
+
+// ndjsonChunkSize is the number of entries expanded and flushed at once
+const ndjsonChunkSize = 100
+
+// wantsNDJSON reports whether the client requested a newline-delimited JSON stream
+func wantsNDJSON(c *gin.Context) bool {
+	return c.Query("format") == "ndjson" || strings.Contains(c.GetHeader("Accept"), "application/x-ndjson")
+}
+
+// findOptions parses filters of recursive tree listings:
+// pattern (repeatable, "!" excludes), type (comma-separated kinds), min_size, max_size and limit
+func findOptions(c *gin.Context, maxDepth int) *repo.FindOptions {
+	opts := &repo.FindOptions{
+		MaxDepth: maxDepth,
+		Patterns: c.QueryArray("pattern"),
+	}
+	if types := c.Query("type"); types != "" {
+		for _, kind := range strings.Split(types, ",") {
+			opts.Kinds = append(opts.Kinds, repo.Kind(strings.TrimSpace(kind)))
+		}
+	}
+	if size, err := strconv.ParseInt(c.Query("min_size"), 10, 64); err == nil && size > 0 {
+		opts.MinSize = size
+	}
+	if size, err := strconv.ParseInt(c.Query("max_size"), 10, 64); err == nil && size > 0 {
+		opts.MaxSize = size
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		opts.Limit = limit
+	}
+	return opts
+}
+
+// streamTreeEntries writes entries one per line while walking the tree.
+// Errors after the response has started are reported by a last line of {"ok":false,"error":...}.
+func streamTreeEntries(s *Server, c *gin.Context, siteName, userName, repoName string, r *repo.Repo, rev string, path string, opts *repo.FindOptions) {
+	exp := parseTreeExpansion(c.Query("expand"))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	enc := json.NewEncoder(c.Writer)
+	chunk := make([]*repo.TreeEntry, 0, ndjsonChunkSize)
+	flush := func() error {
+		s.linkSubmodules(siteName, userName, repoName, chunk)
+		err := r.ExpandTreeEntries(rev, path, chunk, exp)
+		if err != nil {
+			return err
+		}
+		for _, te := range chunk {
+			err := enc.Encode(te)
+			if err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		chunk = chunk[:0]
+		return nil
+	}
+	err := r.Walk(path, rev, opts, func(te *repo.TreeEntry) error {
+		chunk = append(chunk, te)
+		if len(chunk) >= ndjsonChunkSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(chunk) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		enc.Encode(gin.H{"ok": false, "error": err.Error()})
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/taskie/gitan/repo"
+)
+
+const maxSubmoduleDepth = 8
+
+// splitRemoteURL splits a remote URL into the host and the path.
+// The host is empty for relative URLs.
+func splitRemoteURL(rawURL string) (string, string) {
+	if strings.HasPrefix(rawURL, "./") || strings.HasPrefix(rawURL, "../") {
+		return "", rawURL
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Hostname(), u.Path
+	}
+	// scp-like syntax: [user@]host:path
+	if i := strings.Index(rawURL, ":"); i > 0 && !strings.Contains(rawURL[:i], "/") {
+		host := rawURL[:i]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+		return host, rawURL[i+1:]
+	}
+	return "", ""
+}
+
+// linkSubmodule sets the location of the submodule repository if it is hosted by s.
+// Hidden and blob-only repos are not linked since their trees are not to be browsed.
+func (s *Server) linkSubmodule(siteName, userName, repoName string, sm *repo.Submodule) bool {
+	host, p := splitRemoteURL(sm.URL)
+	if p == "" {
+		return false
+	}
+	if host == "" {
+		// relative URLs are resolved against the superproject
+		p = path.Join(userName, repoName, p)
+	} else {
+		siteName = host
+	}
+	p = strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+	site := s.Sites[siteName]
+	if site == nil {
+		return false
+	}
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) == 1 {
+		parts = []string{"-", parts[0]}
+	}
+	user := site.UserRegistries[parts[0]]
+	if user == nil || user.Repos[parts[1]] == nil {
+		return false
+	}
+	settings := user.RepoSettings(parts[1])
+	if settings.Hidden || s.isBlobOnly(settings) {
+		return false
+	}
+	sm.Site = siteName
+	sm.User = parts[0]
+	sm.Repo = parts[1]
+	return true
+}
+
+func (s *Server) linkSubmodules(siteName, userName, repoName string, tes []*repo.TreeEntry) {
+	for _, te := range tes {
+		if te.Submodule != nil {
+			s.linkSubmodule(siteName, userName, repoName, te.Submodule)
+		}
+	}
+}